@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/engine"
+	"github.com/darmiel/ralf/pkg/model"
+	httpsource "github.com/darmiel/ralf/pkg/source/http"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// loadProfile parses the profile file and resolves `extends` relative to it
+func loadProfile(path string) (*model.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profile, err := model.ParseProfileFromYAML(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = profile.ResolveExtends(abs, model.FileLoader); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// loadInput reads the calendar from a file, a URL or stdin (-).
+// Without input, the sources of the profile are requested.
+func loadInput(input string, profile *model.Profile, stdin io.Reader) (*ics.Calendar, error) {
+	switch {
+	case input == "":
+		for _, src := range profile.Source {
+			if err := src.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid source %s: %w", model.SourceName(src), err)
+			}
+		}
+		cals, err := engine.FetchSources(profile.Source, func(src model.Source) (*ics.Calendar, error) {
+			return src.Run()
+		})
+		if err != nil {
+			return nil, err
+		}
+		return engine.MergeSources(cals, profile.SourceConflict)
+	case input == "-":
+		return ics.ParseCalendar(stdin)
+	case strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://"):
+		return (&httpsource.Options{URL: input}).Run()
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ics.ParseCalendar(f)
+}
+
+// output returns the file to write to (stdout if path is empty)
+func output(path string, stdout io.Writer) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type processFlags struct {
+	input   string
+	output  string
+	params  paramFlags
+	debug   bool
+	verbose bool
+	json    bool
+}
+
+func newProcessFlags(name string) (*flag.FlagSet, *processFlags) {
+	pf := &processFlags{params: make(paramFlags)}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&pf.input, "input", "", "input calendar (file, URL or - for stdin)")
+	fs.StringVar(&pf.input, "i", "", "shorthand for --input")
+	fs.StringVar(&pf.output, "output", "", "output file (default: stdout)")
+	fs.StringVar(&pf.output, "o", "", "shorthand for --output")
+	fs.Var(pf.params, "param", "profile parameter (name=value)")
+	fs.Var(pf.params, "p", "shorthand for --param")
+	switch name {
+	case "run":
+		fs.BoolVar(&pf.debug, "debug", false, "print debug messages to stderr")
+		fs.BoolVar(&pf.verbose, "verbose", false, "print what the actions do")
+	case "diff":
+		fs.BoolVar(&pf.json, "json", false, "print the diff as JSON")
+	}
+	return fs, pf
+}
+
+// processed is the result of running the flows of a profile
+type processed struct {
+	flow  *engine.ContextFlow
+	cal   *ics.Calendar
+	flags *processFlags
+	// before is the snapshot of the input calendar (only for diff)
+	before *engine.CalendarSnapshot
+}
+
+// process loads the profile and the input and runs the flows
+func process(s *streams, args []string, name string) (*processed, error) {
+	fs, pf := newProcessFlags(name)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, &usageError{"exactly one profile required"}
+	}
+	profile, err := loadProfile(positional[0])
+	if err != nil {
+		return nil, err
+	}
+	params, err := profile.Params.Resolve(func(name string) (string, bool) {
+		value, ok := pf.params[name]
+		return value, ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan, err := engine.CompileProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := loadInput(pf.input, profile, s.stdin)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load input: %w", err)
+	}
+	res := &processed{cal: cal, flags: pf}
+	if name == "diff" {
+		res.before = engine.Snapshot(cal)
+	}
+	res.flow = &engine.ContextFlow{
+		Profile:     profile,
+		Context:     make(map[string]interface{}),
+		EnableDebug: pf.debug,
+		Verbose:     pf.verbose,
+		// stdout is reserved for the result
+		Output:      s.stderr,
+		EnableTrace: name == "explain",
+		Workers:     runtime.GOMAXPROCS(0),
+		Params:      params,
+	}
+	if err = engine.ModifyCalendar(res.flow, plan, cal); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// runCommand writes the processed calendar
+func runCommand(s *streams, args []string) error {
+	res, err := process(s, args, "run")
+	if err != nil {
+		return err
+	}
+	for _, e := range res.flow.Errors {
+		fmt.Fprintf(s.stderr, "error: %s: %s\n", e.UID, e.Error)
+	}
+	out, err := output(res.flags.output, s.stdout)
+	if err != nil {
+		return err
+	}
+	if err = res.cal.SerializeTo(out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeJSON writes the value as indented JSON
+func writeJSON(path string, stdout io.Writer, v interface{}) error {
+	out, err := output(path, stdout)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(v); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// explainCommand writes the trace of every event as JSON
+func explainCommand(s *streams, args []string) error {
+	res, err := process(s, args, "explain")
+	if err != nil {
+		return err
+	}
+	return writeJSON(res.flags.output, s.stdout, res.flow.Traces)
+}
+
+// diffCommand writes the differences between the input and the processed calendar
+func diffCommand(s *streams, args []string) error {
+	res, err := process(s, args, "diff")
+	if err != nil {
+		return err
+	}
+	diff := res.before.Diff(res.cal)
+	if res.flags.json {
+		return writeJSON(res.flags.output, s.stdout, diff)
+	}
+	out, err := output(res.flags.output, s.stdout)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(out, diff.String()); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// validateCommand validates all profiles and prints their problems
+func validateCommand(s *streams, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return &usageError{"at least one profile required"}
+	}
+	failed := false
+	for _, path := range paths {
+		profile, err := loadProfile(path)
+		if err == nil {
+			err = engine.Validate(profile)
+		}
+		if err == nil {
+			fmt.Fprintf(s.stdout, "%s: ok\n", path)
+			continue
+		}
+		failed = true
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(s.stdout, "%s: %s\n", path, line)
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// testCommand runs the tests of all profiles
+func testCommand(s *streams, args []string) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return &usageError{"at least one profile required"}
+	}
+	var passed, failed int
+	for _, path := range paths {
+		profile, err := loadProfile(path)
+		if err != nil {
+			return err
+		}
+		results, err := engine.RunTests(profile, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if len(results) == 0 {
+			fmt.Fprintf(s.stdout, "?    %s [no tests]\n", path)
+		}
+		for _, res := range results {
+			if res.Passed {
+				passed++
+				fmt.Fprintf(s.stdout, "ok   %s: %s\n", path, res.Name)
+				continue
+			}
+			failed++
+			fmt.Fprintf(s.stdout, "FAIL %s: %s\n", path, res.Name)
+			for _, diff := range res.Diffs {
+				fmt.Fprintf(s.stdout, "    %s\n", diff)
+			}
+		}
+	}
+	fmt.Fprintf(s.stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Command ralf runs, validates, tests and explains profiles without a server
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/darmiel/ralf/pkg/plugin"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// errFailed is returned by commands which already printed why they failed (e.g. failed tests)
+var errFailed = errors.New("failed")
+
+// streams are the standard streams of the commands
+type streams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(s *streams, args []string) error
+}
+
+var commands = map[string]*command{
+	"run": {
+		usage: "run <profile> [--input <file|url|->] [--output <file>] [--param name=value]... [--debug] [--verbose]",
+		run:   runCommand,
+	},
+	"explain": {
+		usage: "explain <profile> [--input <file|url|->] [--output <file>] [--param name=value]...",
+		run:   explainCommand,
+	},
+	"diff": {
+		usage: "diff <profile> [--input <file|url|->] [--output <file>] [--param name=value]... [--json]",
+		run:   diffCommand,
+	},
+	"validate": {
+		usage: "validate <profile>...",
+		run:   validateCommand,
+	},
+	"test": {
+		usage: "test <profile>...",
+		run:   testCommand,
+	},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ralf <command> [arguments]")
+	fmt.Fprintln(w)
+	for _, name := range []string{"run", "explain", "diff", "validate", "test"} {
+		fmt.Fprintln(w, "  ralf "+commands[name].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without --input, the sources of the profile are requested.")
+	fmt.Fprintln(w, "Plugins are registered from the config file in RALF_PLUGINS.")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], &streams{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run runs the command in args and returns the exit code
+func run(args []string, s *streams) int {
+	if len(args) < 1 {
+		usage(s.stderr)
+		return 2
+	}
+	name := args[0]
+	switch name {
+	case "-h", "--help", "help":
+		usage(s.stderr)
+		return 0
+	case "version", "--version":
+		fmt.Fprintln(s.stdout, "ralf", version, "commit:", commit, "at", date)
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(s.stderr, "ralf: unknown command:", name)
+		usage(s.stderr)
+		return 2
+	}
+
+	// register plugin actions declared in the config file
+	if path := os.Getenv("RALF_PLUGINS"); path != "" {
+		plugins, err := plugin.RegisterFile(path)
+		if err != nil {
+			fmt.Fprintln(s.stderr, "ralf: cannot register plugins:", err)
+			return 1
+		}
+		for _, p := range plugins {
+			defer p.Close()
+		}
+	}
+
+	err := cmd.run(s, args[1:])
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(s.stderr, "ralf:", err)
+		fmt.Fprintln(s.stderr, "usage: ralf "+cmd.usage)
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	default:
+		fmt.Fprintln(s.stderr, "ralf:", err)
+		return 1
+	}
+}
+
+// usageError is returned for invalid arguments
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// parseArgs parses flags which can appear before and after the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(new(strings.Builder))
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, &usageError{err.Error()}
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// paramFlags collects repeated --param name=value flags
+type paramFlags map[string]string
+
+func (p paramFlags) String() string {
+	return fmt.Sprint(map[string]string(p))
+}
+
+func (p paramFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got '%s'", value)
+	}
+	p[name] = val
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ralf runs the command line and returns the exit code, stdout and stderr
+func ralf(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &streams{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	code, stdout, stderr := ralf(t, "", "run", "testdata/lectures.yaml",
+		"--input", "testdata/lectures.ics", "--param", "group=B1", "--debug", "--verbose")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "BEGIN:VCALENDAR") || !strings.Contains(stdout, "UID:math") ||
+		strings.Contains(stdout, "UID:physics") || !strings.Contains(stdout, "LOCATION:Room 1") {
+		t.Fatalf("expected the processed calendar on stdout, got:\n%s", stdout)
+	}
+	// debug and verbose messages don't mix with the calendar
+	if strings.Contains(stdout, "[DEBUG]") || !strings.Contains(stderr, "[DEBUG] checking B2 Physics") ||
+		!strings.Contains(stderr, "[actions/set-property] set LOCATION to 'Room 1'") {
+		t.Fatalf("expected debug and verbose messages on stderr, got:\n%s", stderr)
+	}
+
+	// input from stdin and output to a file
+	input, err := os.ReadFile("testdata/lectures.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "out.ics")
+	code, stdout, stderr = ralf(t, string(input), "run", "testdata/lectures.yaml", "-i", "-", "-o", path, "-p", "group=B2")
+	if code != 0 || stdout != "" {
+		t.Fatalf("expected exit code 0 without output, got %d: %s%s", code, stdout, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "UID:physics") || strings.Contains(string(data), "UID:math") {
+		t.Fatalf("expected only physics in the output file, got:\n%s", data)
+	}
+}
+
+func TestDiffAndExplain(t *testing.T) {
+	code, stdout, stderr := ralf(t, "", "diff", "testdata/lectures.yaml", "-i", "testdata/lectures.ics", "-p", "group=B1", "--json")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	var diff struct {
+		Removed []struct{ UID string }
+		Changed []struct{ UID string }
+	}
+	if err := json.Unmarshal([]byte(stdout), &diff); err != nil {
+		t.Fatalf("expected JSON diff, got %v:\n%s", err, stdout)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].UID != "physics" || len(diff.Changed) != 1 || diff.Changed[0].UID != "math" {
+		t.Fatalf("expected physics removed and math changed, got %+v", diff)
+	}
+
+	code, stdout, stderr = ralf(t, "", "explain", "testdata/lectures.yaml", "-i", "testdata/lectures.ics", "-p", "group=B1")
+	if code != 0 || !strings.Contains(stdout, `"verdict": "filter-out"`) {
+		t.Fatalf("expected traces, got %d: %s%s", code, stdout, stderr)
+	}
+}
+
+func TestValidateAndTest(t *testing.T) {
+	code, stdout, _ := ralf(t, "", "validate", "testdata/lectures.yaml", "testdata/invalid.yaml")
+	if code != 1 || !strings.Contains(stdout, "testdata/lectures.yaml: ok") ||
+		!strings.Contains(stdout, "testdata/invalid.yaml: flows[0]: invalid flow identifier: actions/unknown") {
+		t.Fatalf("expected invalid profile to fail validation, got %d:\n%s", code, stdout)
+	}
+
+	code, stdout, _ = ralf(t, "", "test", "testdata/lectures.yaml")
+	if code != 0 || !strings.Contains(stdout, "ok   testdata/lectures.yaml: keeps own group") ||
+		!strings.Contains(stdout, "1 passed, 0 failed") {
+		t.Fatalf("expected passing tests, got %d:\n%s", code, stdout)
+	}
+	code, stdout, _ = ralf(t, "", "test", "testdata/lectures.yaml", "testdata/failing.yaml")
+	if code != 1 || !strings.Contains(stdout, "FAIL testdata/failing.yaml: keeps everything") ||
+		!strings.Contains(stdout, "1 passed, 1 failed") {
+		t.Fatalf("expected failing tests, got %d:\n%s", code, stdout)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{nil, 2, "usage: ralf <command>"},
+		{[]string{"unknown"}, 2, "unknown command: unknown"},
+		{[]string{"run"}, 2, "exactly one profile required"},
+		{[]string{"run", "testdata/lectures.yaml", "--unknown"}, 2, "usage: ralf run"},
+		{[]string{"run", "testdata/lectures.yaml", "-i", "testdata/lectures.ics"}, 1, "missing parameter"},
+		{[]string{"run", "testdata/missing.yaml"}, 1, "no such file"},
+	} {
+		code, stdout, stderr := ralf(t, "", tc.args...)
+		if code != tc.code || stdout != "" || !strings.Contains(stderr, tc.stderr) {
+			t.Fatalf("%v: expected exit code %d and '%s', got %d: %s%s", tc.args, tc.code, tc.stderr, code, stdout, stderr)
+		}
+	}
+}
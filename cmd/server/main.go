@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/darmiel/ralf/internal/server"
+	"github.com/darmiel/ralf/pkg/plugin"
 	"github.com/redis/go-redis/v9"
+	"os"
 )
 
 var (
@@ -29,7 +31,23 @@ func main() {
 		panic(err)
 	}
 
+	// register plugin actions declared in the config file
+	if path := os.Getenv("RALF_PLUGINS"); path != "" {
+		plugins, err := plugin.RegisterFile(path)
+		if err != nil {
+			panic(err)
+		}
+		for _, p := range plugins {
+			defer p.Close()
+			fmt.Println("registered plugin", p.Identifier())
+		}
+	}
+
 	demo := server.New(rc, version, commit, date)
+	// stored profiles which can be referenced by `extends: <id>`
+	if dir := os.Getenv("RALF_PROFILES"); dir != "" {
+		demo.WithProfiles(dir)
+	}
 	if err := demo.Start(); err != nil {
 		panic(err)
 	}
@@ -8,6 +8,7 @@ require (
 	github.com/darmiel/golang-ical v0.0.0-20221121153313-bd526fc4018d
 	github.com/gofiber/fiber/v2 v2.52.5
 	github.com/redis/go-redis/v9 v9.6.1
+	github.com/teambition/rrule-go v1.8.2
 	go.mongodb.org/mongo-driver v1.16.0
 	golang.org/x/net v0.26.0
 	gopkg.in/yaml.v3 v3.0.1
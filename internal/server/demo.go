@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/darmiel/ralf/pkg/model"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/redis/go-redis/v9"
@@ -9,6 +10,14 @@ import (
 type DemoServer struct {
 	app *fiber.App
 	red *redis.Client
+	// profiles loads stored profiles referenced by `extends` (nil if not configured)
+	profiles model.ProfileLoader
+}
+
+// WithProfiles allows profiles to extend the stored profiles in the directory (<dir>/<id>.yaml)
+func (d *DemoServer) WithProfiles(dir string) *DemoServer {
+	d.profiles = model.DirLoader(dir)
+	return d
 }
 
 func (d *DemoServer) Start() error {
@@ -21,6 +30,7 @@ type info struct {
 	Date    string `json:"date"`
 }
 
+// New creates the server. Sources are not cached if rc is nil.
 func New(rc *redis.Client, version, commit, date string) *DemoServer {
 	app := fiber.New()
 	d := &DemoServer{
@@ -35,6 +45,9 @@ func New(rc *redis.Client, version, commit, date string) *DemoServer {
 	}))
 	app.Post("/process", d.routeProcessPost)
 	app.Get("/process", d.routeProcessGet)
+	app.Post("/diff", d.routeDiffPost)
+	app.Get("/diff", d.routeDiffGet)
+	app.Get("/schema.json", d.routeSchema)
 	app.Get("/icanhasralf", func(ctx *fiber.Ctx) error {
 		return ctx.JSON(&info{
 			Version: version,
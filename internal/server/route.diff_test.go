@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/darmiel/ralf/pkg/engine"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const diffTestProfile = `
+source:
+  type: http
+  url: %s
+recurrence:
+  mode: expand
+flows:
+  - if: 'Event.Summary() contains "Physics"'
+    then:
+      - do: filters/filter-out
+  - if: 'Event.Summary() contains "Math"'
+    then:
+      - do: actions/set-property
+        with:
+          property: location
+          value: Room 1
+`
+
+// newDiffTestServer returns a server and a profile which removes physics, changes math
+// and expands a weekly event with two occurrences (removed master, added occurrences)
+func newDiffTestServer(t *testing.T) (*DemoServer, string) {
+	start := time.Now().UTC().Truncate(time.Hour).Add(-24 * time.Hour)
+	weekly := "BEGIN:VEVENT\r\nUID:weekly\r\nSUMMARY:Weekly\r\n" +
+		"DTSTART:" + start.Format("20060102T150405Z") + "\r\nDTEND:" + start.Add(time.Hour).Format("20060102T150405Z") + "\r\n" +
+		"RRULE:FREQ=WEEKLY;COUNT=2\r\nEND:VEVENT\r\n"
+	feed := serveFeed(t, strings.Replace(testFeed, "END:VCALENDAR", weekly+"END:VCALENDAR", 1))
+	return New(nil, "test", "", ""), strings.Replace(diffTestProfile, "%s", feed, 1)
+}
+
+func TestDiffJSON(t *testing.T) {
+	d, profile := newDiffTestServer(t)
+	status, body := do(t, d, httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(profile)))
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	var diff engine.CalendarDiff
+	if err := json.Unmarshal([]byte(body), &diff); err != nil {
+		t.Fatalf("expected JSON diff, got %v: %s", err, body)
+	}
+	var removed []string
+	for _, e := range diff.Removed {
+		removed = append(removed, e.UID)
+	}
+	if strings.Join(removed, ",") != "physics,weekly" {
+		t.Fatalf("expected physics and the weekly master to be removed, got %v", removed)
+	}
+	if len(diff.Added) != 2 || !strings.HasPrefix(diff.Added[0].UID, "weekly-") || diff.Added[0].Summary != "Weekly" {
+		t.Fatalf("expected two added occurrences, got %+v", diff.Added)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].UID != "math" || len(diff.Changed[0].Changes) != 1 {
+		t.Fatalf("expected math to be changed, got %+v", diff.Changed)
+	}
+	if change := diff.Changed[0].Changes[0]; change.Property != "LOCATION" || len(change.Before) != 0 ||
+		strings.Join(change.After, ",") != "Room 1" {
+		t.Fatalf("expected LOCATION to be added, got %+v", change)
+	}
+	if diff.Unchanged != 0 {
+		t.Fatalf("expected no unchanged events, got %d", diff.Unchanged)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	d, profile := newDiffTestServer(t)
+	tpl := url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(profile)))
+	status, body := do(t, d, httptest.NewRequest(http.MethodGet, "/diff?format=text&tpl="+tpl, nil))
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	for _, line := range []string{
+		"- physics: B2 Physics @ 20230102T120000Z\n",
+		"- weekly: Weekly @ ",
+		"+ weekly-",
+		"~ math: B1 Math @ 20230102T080000Z\n    LOCATION: '' -> 'Room 1'\n",
+		"2 removed, 2 added, 1 changed, 0 unchanged\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("expected %q in the text diff, got:\n%s", line, body)
+		}
+	}
+
+	// without format, the diff is returned as JSON
+	status, body = do(t, d, httptest.NewRequest(http.MethodGet, "/diff?tpl="+tpl, nil))
+	if status != http.StatusOK || !strings.HasPrefix(body, "{") {
+		t.Fatalf("expected JSON diff, got %d: %s", status, body)
+	}
+}
+
+func TestDiffInvalidProfile(t *testing.T) {
+	d, _ := newTestServer(t)
+	status, _ := do(t, d, httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader("flows: []\n")))
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400 without source, got %d", status)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"gopkg.in/yaml.v3"
 	"net/http"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -23,13 +24,23 @@ var client = &http.Client{
 	Timeout: 20 * time.Second,
 }
 
+// processLimits restrict the execution of the (untrusted) flows of a profile
+var processLimits = engine.Limits{
+	MaxDepth:         32,
+	MaxStepsPerEvent: 10_000,
+	MaxSteps:         1_000_000,
+}
+
+// processTimeout is the maximum time to request the sources and run the flows of a profile
+var processTimeout = 10 * time.Second
+
 func (d *DemoServer) getSourceWithRequest(
 	ctx context.Context,
 	source model.Source,
 	cache time.Duration,
 	cacheKey string,
 ) (*ics.Calendar, error) {
-	cal, err := source.Run()
+	cal, err := runSource(ctx, source)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +50,30 @@ func (d *DemoServer) getSourceWithRequest(
 	return cal, nil
 }
 
+// runSource requests the source and stops waiting for it if ctx is done
+func runSource(ctx context.Context, source model.Source) (*ics.Calendar, error) {
+	type result struct {
+		cal *ics.Calendar
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		cal, err := source.Run()
+		done <- result{cal, err}
+	}()
+	select {
+	case res := <-done:
+		return res.cal, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (d *DemoServer) getSource(ctx context.Context, source model.Source, cache time.Duration) (*ics.Calendar, error) {
+	// caching is disabled without redis
+	if d.red == nil {
+		return runSource(ctx, source)
+	}
 	cacheKey, err := source.CacheKey()
 	if err != nil {
 		return nil, err
@@ -54,7 +88,8 @@ func (d *DemoServer) getSource(ctx context.Context, source model.Source, cache t
 	return ics.ParseCalendar(strings.NewReader(body))
 }
 
-func (d *DemoServer) routeProcessDo(content []byte, ctx *fiber.Ctx) error {
+// routeProcessDo runs the profile. With diff, the changes to the source calendar are returned instead of the calendar.
+func (d *DemoServer) routeProcessDo(content []byte, ctx *fiber.Ctx, diff bool) error {
 	// try to parse body
 	var profile model.Profile
 	dec := yaml.NewDecoder(bytes.NewReader(content))
@@ -63,13 +98,23 @@ func (d *DemoServer) routeProcessDo(content []byte, ctx *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid RALF-SPEC ("+err.Error()+")")
 	}
 
-	if len(profile.Source) != 1 {
-		return fiber.NewError(fiber.StatusBadRequest, "only one source is allowed")
+	// merge the stored profiles the profile extends
+	if profile.Extends != "" {
+		if d.profiles == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "extends is not supported (no stored profiles)")
+		}
+		if err := profile.ResolveExtends("", d.profiles); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "cannot resolve extends ("+err.Error()+")")
+		}
 	}
-	source := profile.Source[0]
 
-	if err := source.Validate(); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid source ("+err.Error()+")")
+	if len(profile.Source) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "source required")
+	}
+	for _, source := range profile.Source {
+		if err := source.Validate(); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid source "+model.SourceName(source)+" ("+err.Error()+")")
+		}
 	}
 
 	// require a cache duration of at least 120s
@@ -78,10 +123,43 @@ func (d *DemoServer) routeProcessDo(content []byte, ctx *fiber.Ctx) error {
 		cd = 2 * time.Minute
 	}
 
-	cal, err := d.getSource(ctx.Context(), source, cd)
+	// parameters of the profile are supplied as query parameters or form values, e.g. ?group=B1 or ?p.group=B1
+	params, err := profile.Params.Resolve(func(name string) (string, bool) {
+		return paramValue(ctx, name)
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid parameters ("+err.Error()+")")
+	}
+
+	// compile all expressions before requesting the source
+	plan, err := engine.CompileProfile(&profile)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid flows ("+err.Error()+")")
+	}
+
+	// the sources and the flows share the time limit
+	runCtx, cancel := context.WithTimeout(ctx.Context(), processTimeout)
+	defer cancel()
+
+	// every source is cached separately
+	cals, err := engine.FetchSources(profile.Source, func(source model.Source) (*ics.Calendar, error) {
+		return d.getSource(runCtx, source, cd)
+	})
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "source request timed out ("+err.Error()+")")
+		}
 		return fiber.NewError(fiber.StatusInternalServerError, "cannot request source ("+err.Error()+")")
 	}
+	cal, err := engine.MergeSources(cals, profile.SourceConflict)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "cannot merge sources ("+err.Error()+")")
+	}
+
+	var before *engine.CalendarSnapshot
+	if diff {
+		before = engine.Snapshot(cal)
+	}
 
 	// create context and run flow
 	cp := &engine.ContextFlow{
@@ -89,34 +167,152 @@ func (d *DemoServer) routeProcessDo(content []byte, ctx *fiber.Ctx) error {
 		Context:     make(map[string]interface{}),
 		EnableDebug: true,
 		Verbose:     true,
+		Workers:     runtime.GOMAXPROCS(0),
+		Params:      params,
+		Limits:      processLimits,
+		RunContext:  runCtx,
+		// ?explain=true returns the trace of every event instead of the calendar
+		EnableTrace: ctx.Query("explain") == "true",
 	}
-	if err = engine.ModifyCalendar(cp, profile.Flows, cal); err != nil {
+	if err = engine.ModifyCalendar(cp, plan, cal); err != nil {
+		// time spent running the flows is caused by the profile, only slow sources return 503
+		if errors.Is(err, engine.ErrLimitExceeded) {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "flow exceeded a limit ("+err.Error()+")")
+		}
 		return fiber.NewError(fiber.StatusInternalServerError, "failed to run flow ("+err.Error()+")")
 	}
 
+	if cp.EnableTrace {
+		return ctx.JSON(cp.Traces)
+	}
+	if diff {
+		// ?format=text returns the human-readable diff
+		if ctx.Query("format") == "text" {
+			return ctx.SendString(before.Diff(cal).String())
+		}
+		return ctx.JSON(before.Diff(cal))
+	}
+
 	// append debug messages as header
 	ctx.Append("X-Debug-Message-Count", strconv.Itoa(len(cp.Debugs)))
 	for i, v := range cp.Debugs {
 		ctx.Append(fmt.Sprintf("X-Debug-Message-%d", i+1), fmt.Sprintf("%+v", v))
 	}
 
+	// append errors of skipped or kept events (on-error policy) as header
+	ctx.Append("X-Error-Count", strconv.Itoa(len(cp.Errors)))
+	for i, e := range cp.Errors {
+		ctx.Append(fmt.Sprintf("X-Error-%d", i+1), e.UID+": "+e.Error)
+	}
+
 	// append content-type and return calendar
 	ctx.Set("Content-Type", "text/calendar")
 	return ctx.Status(201).SendString(cal.Serialize())
 }
 
-func (d *DemoServer) routeProcessGet(ctx *fiber.Ctx) error {
+// paramPrefix namespaces profile parameters in the query string and the form body, e.g. `?p.group=B1`
+const paramPrefix = "p."
+
+// reservedKeys are used by the server itself, parameters with these names require the prefix
+var reservedKeys = map[string]bool{
+	"tpl":     true,
+	"profile": true,
+	"explain": true,
+	"format":  true,
+}
+
+// paramValue returns the value of a profile parameter.
+// The prefixed name takes precedence, the plain name is used unless it is a reserved key.
+func paramValue(ctx *fiber.Ctx, name string) (string, bool) {
+	if value, ok := formValue(ctx, paramPrefix+name); ok {
+		return value, true
+	}
+	if reservedKeys[name] {
+		return "", false
+	}
+	return formValue(ctx, name)
+}
+
+// isForm returns true if the request body is a form instead of a profile
+func isForm(ctx *fiber.Ctx) bool {
+	contentType := string(ctx.Request().Header.ContentType())
+	return strings.HasPrefix(contentType, fiber.MIMEApplicationForm) ||
+		strings.HasPrefix(contentType, fiber.MIMEMultipartForm)
+}
+
+// formValue returns a value from the query string or the form body
+func formValue(ctx *fiber.Ctx, key string) (string, bool) {
+	if args := ctx.Context().QueryArgs(); args.Has(key) {
+		return string(args.Peek(key)), true
+	}
+	if !isForm(ctx) {
+		return "", false
+	}
+	if args := ctx.Context().PostArgs(); args.Has(key) {
+		return string(args.Peek(key)), true
+	}
+	if form, err := ctx.MultipartForm(); err == nil {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+// bodyProfile returns the profile of the request body.
+// Form bodies contain the profile in the `profile` field next to the parameters.
+func bodyProfile(ctx *fiber.Ctx) ([]byte, error) {
+	if !isForm(ctx) {
+		return ctx.Body(), nil
+	}
+	content, ok := formValue(ctx, "profile")
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "`profile` field missing.")
+	}
+	return []byte(content), nil
+}
+
+// queryProfile returns the base64 encoded profile of the `tpl` parameter
+func queryProfile(ctx *fiber.Ctx) ([]byte, error) {
 	q := ctx.Query("tpl")
 	if q == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "`tpl` (base64) parameter missing.")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "`tpl` (base64) parameter missing.")
 	}
 	content, err := base64.StdEncoding.DecodeString(q)
 	if err != nil {
-		return fiber.NewError(fiber.StatusExpectationFailed, "invalid base64 ("+err.Error()+")")
+		return nil, fiber.NewError(fiber.StatusExpectationFailed, "invalid base64 ("+err.Error()+")")
+	}
+	return content, nil
+}
+
+func (d *DemoServer) routeProcessGet(ctx *fiber.Ctx) error {
+	content, err := queryProfile(ctx)
+	if err != nil {
+		return err
 	}
-	return d.routeProcessDo(content, ctx)
+	return d.routeProcessDo(content, ctx, false)
 }
 
 func (d *DemoServer) routeProcessPost(ctx *fiber.Ctx) error {
-	return d.routeProcessDo(ctx.Body(), ctx)
+	content, err := bodyProfile(ctx)
+	if err != nil {
+		return err
+	}
+	return d.routeProcessDo(content, ctx, false)
+}
+
+func (d *DemoServer) routeDiffGet(ctx *fiber.Ctx) error {
+	content, err := queryProfile(ctx)
+	if err != nil {
+		return err
+	}
+	return d.routeProcessDo(content, ctx, true)
+}
+
+func (d *DemoServer) routeDiffPost(ctx *fiber.Ctx) error {
+	content, err := bodyProfile(ctx)
+	if err != nil {
+		return err
+	}
+	return d.routeProcessDo(content, ctx, true)
 }
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFeed = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\nUID:math\r\nSUMMARY:B1 Math\r\nDTSTART:20230102T080000Z\r\nDTEND:20230102T090000Z\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:physics\r\nSUMMARY:B2 Physics\r\nDTSTART:20230102T120000Z\r\nDTEND:20230102T130000Z\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// newTestServer returns a server without redis and the URL of a feed serving testFeed
+func newTestServer(t *testing.T) (*DemoServer, string) {
+	return New(nil, "test", "", ""), serveFeed(t, testFeed)
+}
+
+// serveFeed returns the URL of a feed serving the calendar
+func serveFeed(t *testing.T, cal string) string {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, cal)
+	}))
+	t.Cleanup(feed.Close)
+	return feed.URL
+}
+
+// do sends the request and returns the status code and the body
+func do(t *testing.T, d *DemoServer, req *http.Request) (int, string) {
+	resp, err := d.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+const paramsTestProfile = `
+source:
+  type: http
+  url: %s
+params:
+  group: {}
+flows:
+  - if: 'not (Event.Summary() startsWith Params.group)'
+    then:
+      - do: filters/filter-out
+`
+
+func TestProcessParams(t *testing.T) {
+	d, feed := newTestServer(t)
+	profile := strings.Replace(paramsTestProfile, "%s", feed, 1)
+
+	// query string
+	tpl := base64.StdEncoding.EncodeToString([]byte(profile))
+	status, body := do(t, d, httptest.NewRequest(http.MethodGet, "/process?p.group=B1&tpl="+url.QueryEscape(tpl), nil))
+	if status != http.StatusCreated || !strings.Contains(body, "UID:math") || strings.Contains(body, "UID:physics") {
+		t.Fatalf("query: unexpected response %d: %s", status, body)
+	}
+
+	// parameters can be supplied without prefix, the prefixed value takes precedence
+	status, body = do(t, d, httptest.NewRequest(http.MethodGet, "/process?group=B1&tpl="+url.QueryEscape(tpl), nil))
+	if status != http.StatusCreated || !strings.Contains(body, "UID:math") || strings.Contains(body, "UID:physics") {
+		t.Fatalf("unprefixed: unexpected response %d: %s", status, body)
+	}
+	status, body = do(t, d, httptest.NewRequest(http.MethodGet, "/process?group=B1&p.group=B2&tpl="+url.QueryEscape(tpl), nil))
+	if status != http.StatusCreated || !strings.Contains(body, "UID:physics") || strings.Contains(body, "UID:math") {
+		t.Fatalf("prefixed: unexpected response %d: %s", status, body)
+	}
+
+	// parameters named like reserved keys require the prefix
+	reserved := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(profile, "group", "format")))
+	status, _ = do(t, d, httptest.NewRequest(http.MethodGet, "/process?format=B1&tpl="+url.QueryEscape(reserved), nil))
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing parameter, got %d", status)
+	}
+	status, body = do(t, d, httptest.NewRequest(http.MethodGet, "/process?p.format=B1&tpl="+url.QueryEscape(reserved), nil))
+	if status != http.StatusCreated || !strings.Contains(body, "UID:math") {
+		t.Fatalf("reserved: unexpected response %d: %s", status, body)
+	}
+
+	// form body
+	form := url.Values{"profile": {profile}, "p.group": {"B2"}}
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	status, body = do(t, d, req)
+	if status != http.StatusCreated || !strings.Contains(body, "UID:physics") || strings.Contains(body, "UID:math") {
+		t.Fatalf("form: unexpected response %d: %s", status, body)
+	}
+}
+
+func TestProcessSourceTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { processTimeout = timeout }(processTimeout)
+	processTimeout = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, testFeed)
+	}))
+	defer feed.Close()
+	defer close(release)
+
+	d := New(nil, "test", "", "")
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader("source: "+feed.URL+"\nflows: []\n"))
+	if status, body := do(t, d, req); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a slow source, got %d: %s", status, body)
+	}
+}
+
+func TestProcessFlowTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { processTimeout = timeout }(processTimeout)
+	processTimeout = 200 * time.Millisecond
+
+	// expanding every second since 2000 takes longer than the time limit
+	feed := serveFeed(t, strings.Replace(testFeed, "END:VCALENDAR",
+		"BEGIN:VEVENT\r\nUID:ticker\r\nDTSTART:20000101T000000Z\r\nRRULE:FREQ=SECONDLY\r\nEND:VEVENT\r\nEND:VCALENDAR", 1))
+	d := New(nil, "test", "", "")
+	req := httptest.NewRequest(http.MethodPost, "/process",
+		strings.NewReader("source: "+feed+"\nrecurrence:\n  mode: expand\nflows: []\n"))
+	if status, body := do(t, d, req); status != http.StatusUnprocessableEntity || !strings.Contains(body, "deadline") {
+		t.Fatalf("expected 422 for slow flows, got %d: %s", status, body)
+	}
+}
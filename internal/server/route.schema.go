@@ -0,0 +1,11 @@
+package server
+
+import (
+	"github.com/darmiel/ralf/pkg/schema"
+	"github.com/gofiber/fiber/v2"
+)
+
+// routeSchema returns the JSON Schema of profiles, e.g. for autocompletion in editors
+func (d *DemoServer) routeSchema(ctx *fiber.Ctx) error {
+	return ctx.JSON(schema.Generate(), "application/schema+json")
+}
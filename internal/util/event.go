@@ -5,11 +5,101 @@ import (
 	"strings"
 )
 
-func HasAttendee(event *ics.VEvent, mail string) bool {
-	for _, a := range event.Attendees() {
+// Attendees returns all ATTENDEE properties of a component
+func Attendees(base *ics.ComponentBase) (r []*ics.Attendee) {
+	for _, p := range base.Properties {
+		if p.IANAToken == string(ics.ComponentPropertyAttendee) {
+			r = append(r, &ics.Attendee{IANAProperty: p})
+		}
+	}
+	return
+}
+
+func HasAttendee(base *ics.ComponentBase, mail string) bool {
+	for _, a := range Attendees(base) {
 		if strings.ToLower(a.Email()) == strings.ToLower(mail) {
 			return true
 		}
 	}
 	return false
 }
+
+// RemoveAttendee removes all ATTENDEE properties with the mail and returns the number of removed attendees
+func RemoveAttendee(base *ics.ComponentBase, mail string) (removed int) {
+	for i := len(base.Properties) - 1; i >= 0; i-- {
+		p := base.Properties[i]
+		if p.IANAToken != string(ics.ComponentPropertyAttendee) {
+			continue
+		}
+		if strings.EqualFold((&ics.Attendee{IANAProperty: p}).Email(), mail) {
+			base.Properties = append(base.Properties[:i], base.Properties[i+1:]...)
+			removed++
+		}
+	}
+	return
+}
+
+// CloneProperties returns a deep copy of properties
+func CloneProperties(props []ics.IANAProperty) []ics.IANAProperty {
+	res := make([]ics.IANAProperty, len(props))
+	for i, p := range props {
+		res[i] = p
+		if p.ICalParameters != nil {
+			params := make(map[string][]string, len(p.ICalParameters))
+			for k, v := range p.ICalParameters {
+				params[k] = append([]string(nil), v...)
+			}
+			res[i].ICalParameters = params
+		}
+	}
+	return res
+}
+
+// CloneEvent returns a deep copy of an event including its alarms
+func CloneEvent(event *ics.VEvent) *ics.VEvent {
+	return &ics.VEvent{ComponentBase: CloneComponentBase(&event.ComponentBase)}
+}
+
+// CloneComponentBase returns a deep copy of the properties and alarms of a component
+func CloneComponentBase(base *ics.ComponentBase) ics.ComponentBase {
+	var clone ics.ComponentBase
+	clone.Properties = CloneProperties(base.Properties)
+	for _, c := range base.Components {
+		if alarm, ok := c.(*ics.VAlarm); ok {
+			a := &ics.VAlarm{}
+			a.Properties = CloneProperties(alarm.Properties)
+			a.Components = append([]ics.Component(nil), alarm.Components...)
+			c = a
+		}
+		clone.Components = append(clone.Components, c)
+	}
+	return clone
+}
+
+// GetCalendarProperty returns the value of a calendar property or an empty string
+func GetCalendarProperty(cal *ics.Calendar, property string) string {
+	for _, p := range cal.CalendarProperties {
+		if p.IANAToken == property {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// SetCalendarProperty sets the value of a calendar property or adds it if it doesn't exist
+func SetCalendarProperty(cal *ics.Calendar, property, value string, params map[string][]string) {
+	for i := range cal.CalendarProperties {
+		if cal.CalendarProperties[i].IANAToken == property {
+			cal.CalendarProperties[i].Value = value
+			cal.CalendarProperties[i].ICalParameters = params
+			return
+		}
+	}
+	cal.CalendarProperties = append(cal.CalendarProperties, ics.CalendarProperty{
+		BaseProperty: ics.BaseProperty{
+			IANAToken:      property,
+			Value:          value,
+			ICalParameters: params,
+		},
+	})
+}
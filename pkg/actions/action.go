@@ -3,27 +3,32 @@ package actions
 import (
 	"errors"
 	"fmt"
+	"github.com/antonmedv/expr/vm"
 	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"io"
+	"os"
 )
 
-var Actions = []Action{
+// eventActions can be used in flows, see Register, Find and List
+var eventActions = []Action{
 	new(FilterInAction),
 	new(FilterOutAction),
 	new(RegexReplaceAction),
+	new(SetPropertyAction),
 	new(ClearAttendeesAction),
 	new(AddAttendeeAction),
+	new(RemoveAttendeeAction),
 	new(ClearAlarmsAction),
 	new(AddAlarmAction),
 	new(CtxSetAction),
 }
 
+// Find returns the action with the identifier or nil
 func Find(identifier string) Action {
-	for _, act := range Actions {
-		if act.Identifier() == identifier {
-			return act
-		}
-	}
-	return nil
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return findIn(eventActions, identifier)
 }
 
 type Action interface {
@@ -31,21 +36,76 @@ type Action interface {
 	Execute(ctx *Context) (ActionMessage, error)
 }
 
+// Compiler is implemented by actions which evaluate expressions from their `with` values.
+// The compiled programs are passed back to Execute in Context.Programs.
+type Compiler interface {
+	Compile(with map[string]interface{}) (map[string]*vm.Program, error)
+}
+
 type Context struct {
+	// Component is the event (or task, journal entry) the action is executed for
+	Component *environ.Component
+	// Event is the event the action is executed for (nil for tasks and journal entries).
+	//
+	// Deprecated: use Component, which also supports tasks and journal entries.
 	Event         *ics.VEvent
 	SharedContext map[string]interface{}
 	With          map[string]interface{}
 	Verbose       bool
+	// Output receives verbose messages (os.Stdout if nil)
+	Output io.Writer
+	// Programs contains the pre-compiled expressions (if the action is a Compiler)
+	Programs map[string]*vm.Program
+	// Params contains the values of the profile parameters
+	Params map[string]interface{}
+}
+
+// Logf writes a verbose message to Output if Verbose is enabled
+func (c *Context) Logf(format string, args ...interface{}) {
+	if c.Verbose {
+		logf(c.Output, format, args...)
+	}
+}
+
+// logf writes a message followed by a newline to out (os.Stdout if nil)
+func logf(out io.Writer, format string, args ...interface{}) {
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = fmt.Fprintf(out, format+"\n", args...)
+}
+
+// Env creates the expression environment for the component
+func (c *Context) Env() (*environ.ExprEnvironment, error) {
+	env, err := environ.CreateExprEnvironment(c.Component, c.SharedContext)
+	if err != nil {
+		return nil, err
+	}
+	env.Params = c.Params
+	return env, nil
 }
 
 type ActionMessage interface {
 }
 
+// Filter messages set the verdict of the event.
+// Final verdicts can't be changed by later flows.
 type (
-	FilterOutActionMessage struct{}
-	FilterInActionMessage  struct{}
+	FilterOutActionMessage struct {
+		Final bool
+	}
+	FilterInActionMessage struct {
+		Final bool
+	}
 )
 
+// filterSchema is the schema of the filter actions
+var filterSchema = &Schema{
+	Parameters: []*Parameter{
+		{Name: "final", Type: TypeBool, Description: "later flows can't change the verdict"},
+	},
+}
+
 func required[T any](with map[string]interface{}, key string) (T, error) {
 	ifa, ok := with[key]
 	if !ok {
@@ -78,6 +138,26 @@ func has(with map[string]interface{}, key string) (ok bool) {
 	return
 }
 
+// integer returns an optional number from with.
+// YAML decodes numbers as int while JSON decodes them as float64.
+func integer(with map[string]interface{}, key string, def int) (int, error) {
+	ifa, ok := with[key]
+	if !ok {
+		return def, nil
+	}
+	switch v := ifa.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("'%s' must be an integer", key))
+}
+
 func strArray(with map[string]interface{}, key string, def []interface{}) ([]string, error) {
 	in, err := optional[[]interface{}](with, key, def)
 	if err != nil {
@@ -2,6 +2,8 @@ package actions
 
 import (
 	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"reflect"
 	"testing"
 )
 
@@ -15,7 +17,7 @@ type test struct {
 }
 
 func getAction(name string) (Action, bool) {
-	for _, a := range Actions {
+	for _, a := range eventActions {
 		if a.Identifier() == name {
 			return a, true
 		}
@@ -35,6 +37,11 @@ func TestMixed(t *testing.T) {
 			action:  "filters/filter-out",
 			message: new(FilterOutActionMessage),
 		},
+		{
+			action:  "filters/filter-out",
+			with:    map[string]interface{}{"final": true},
+			message: &FilterOutActionMessage{Final: true},
+		},
 		{
 			action:  "actions/regex-replace",
 			message: nil,
@@ -122,7 +129,7 @@ func TestMixed(t *testing.T) {
 		}
 		sharedContext := make(map[string]interface{})
 		ctx := &Context{
-			Event:         event,
+			Component:     environ.NewComponent(event),
 			SharedContext: sharedContext,
 			With:          c.with,
 			Verbose:       false,
@@ -133,7 +140,7 @@ func TestMixed(t *testing.T) {
 		} else if err != nil && !c.error {
 			t.Fatalf("got error %v for test %d but no error expected", err, i+1)
 		}
-		if resp != c.message {
+		if !reflect.DeepEqual(resp, c.message) {
 			t.Fatalf("expected return %v but got %v", c.message, resp)
 		}
 		if c.check != nil && !c.check(event) {
@@ -24,6 +24,19 @@ func (rra *RegexReplaceAction) Identifier() string {
 	return "actions/regex-replace"
 }
 
+func (rra *RegexReplaceAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "match", Type: TypeString, Description: "regular expression to replace"},
+			{Name: "replace", Type: TypeString, Description: "replacement, can contain $1, $2, ..."},
+			{Name: "map", Type: TypeList, Description: "list of match / replace pairs"},
+			{Name: "in", Type: TypeList, Description: "properties to replace in (default: description)"},
+			{Name: CaseSensitiveKey, Type: TypeBool},
+		},
+		OneOf: [][]string{{"match", "replace"}, {"map"}},
+	}
+}
+
 ///
 
 type mapReplacers struct {
@@ -184,7 +197,7 @@ func (rra *RegexReplaceAction) Execute(ctx *Context) (ActionMessage, error) {
 
 		// check if the property even exists
 		prop := ics.ComponentProperty(strings.ToUpper(s))
-		val := ctx.Event.GetProperty(prop)
+		val := ctx.Component.GetProperty(prop)
 		if val == nil {
 			continue
 		}
@@ -202,10 +215,8 @@ func (rra *RegexReplaceAction) Execute(ctx *Context) (ActionMessage, error) {
 					upd = r.Do(upd)
 				}
 				if upd != v {
-					if ctx.Verbose {
-						fmt.Printf("[actions/regex-replace] ~Param[%s] '%s' changed to '%s'\n",
-							param, v, upd)
-					}
+					ctx.Logf("[actions/regex-replace] ~Param[%s] '%s' changed to '%s'",
+						param, v, upd)
 					values[i] = upd
 					save = true
 				}
@@ -223,10 +234,8 @@ func (rra *RegexReplaceAction) Execute(ctx *Context) (ActionMessage, error) {
 
 			// only print if something changed
 			if val.Value != upd {
-				if ctx.Verbose {
-					fmt.Printf("[actions/regex-replace] ~Param+(%s) '%s' changed to '%s'\n",
-						strings.ToUpper(s), val.Value, upd)
-				}
+				ctx.Logf("[actions/regex-replace] ~Param+(%s) '%s' changed to '%s'",
+					strings.ToUpper(s), val.Value, upd)
 				save = true
 			}
 		}
@@ -234,7 +243,7 @@ func (rra *RegexReplaceAction) Execute(ctx *Context) (ActionMessage, error) {
 		if save {
 			// apply changes
 			kv := mapToKV(val.ICalParameters)
-			ctx.Event.SetProperty(prop, upd, kv...)
+			ctx.Component.SetProperty(prop, upd, kv...)
 		}
 	}
 
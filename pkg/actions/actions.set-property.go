@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPropertyParams = errors.New("params must map names to a string or a list of strings")
+	ErrUnterminatedTemplate  = errors.New("unterminated ${ in template")
+)
+
+// modes of actions/set-property
+const (
+	SetPropertyModeSet = "set"
+	SetPropertyModeAdd = "add"
+)
+
+type SetPropertyAction struct{}
+
+func (*SetPropertyAction) Identifier() string {
+	return "actions/set-property"
+}
+
+func (*SetPropertyAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "property", Type: TypeString, Required: true, Description: "e.g. DESCRIPTION or X-ROOM"},
+			{Name: "value", Type: TypeString},
+			{Name: "$value", Type: TypeExpression},
+			{Name: "template", Type: TypeString, Description: "text with ${expression} placeholders"},
+			{Name: "params", Type: TypeAny, Description: "parameters of the property, e.g. LANGUAGE: de"},
+			{Name: "mode", Type: TypeString, Enum: []string{SetPropertyModeSet, SetPropertyModeAdd},
+				Description: "replace all values of the property (default) or add another one"},
+			{Name: "escape", Type: TypeBool, Description: "escape the value as TEXT (e.g. commas and newlines)"},
+		},
+		OneOf: [][]string{{"value"}, {"$value"}, {"template"}},
+	}
+}
+
+// templateExpression converts a template to an expression which concatenates the text and the placeholders
+func templateExpression(tpl string) (string, error) {
+	var parts []string
+	for {
+		start := strings.Index(tpl, "${")
+		if start < 0 {
+			break
+		}
+		end := matchingBrace(tpl, start+2)
+		if end < 0 {
+			return "", ErrUnterminatedTemplate
+		}
+		if start > 0 {
+			parts = append(parts, strconv.Quote(tpl[:start]))
+		}
+		parts = append(parts, "String("+tpl[start+2:end]+")")
+		tpl = tpl[end+1:]
+	}
+	if tpl != "" || len(parts) == 0 {
+		parts = append(parts, strconv.Quote(tpl))
+	}
+	return strings.Join(parts, " + "), nil
+}
+
+// matchingBrace returns the index of the brace closing the expression starting at from or -1.
+// Expressions can contain braces (e.g. maps), braces in string literals are ignored.
+func matchingBrace(tpl string, from int) int {
+	depth := 0
+	var quote byte
+	for i := from; i < len(tpl); i++ {
+		c := tpl[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && quote != '`':
+				i++ // skip the escaped character
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// source returns the expression of `$value` or `template`
+func (*SetPropertyAction) source(with map[string]interface{}) (key, code string, err error) {
+	if has(with, "$value") {
+		code, err = required[string](with, "$value")
+		return "$value", code, err
+	}
+	tpl, err := required[string](with, "template")
+	if err != nil {
+		return "", "", err
+	}
+	code, err = templateExpression(tpl)
+	return "template", code, err
+}
+
+// Compile compiles `$value` or `template`
+func (a *SetPropertyAction) Compile(with map[string]interface{}) (map[string]*vm.Program, error) {
+	if _, err := propertyParams(with); err != nil {
+		return nil, err
+	}
+	if !has(with, "$value") && !has(with, "template") {
+		return nil, nil
+	}
+	key, code, err := a.source(with)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := expr.Compile(code, expr.Env(new(environ.ExprEnvironment)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile '%s': %v", key, err)
+	}
+	return map[string]*vm.Program{key: prog}, nil
+}
+
+// propertyParams returns the parameters of the property sorted by name
+func propertyParams(with map[string]interface{}) ([]ics.PropertyParameter, error) {
+	raw, err := optional[map[string]interface{}](with, "params", nil)
+	if err != nil {
+		return nil, ErrInvalidPropertyParams
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]ics.PropertyParameter, len(names))
+	for i, name := range names {
+		var values []string
+		switch v := raw[name].(type) {
+		case string:
+			values = []string{v}
+		case []interface{}:
+			if values, err = strArray(raw, name, nil); err != nil {
+				return nil, ErrInvalidPropertyParams
+			}
+		default:
+			return nil, ErrInvalidPropertyParams
+		}
+		res[i] = &ics.KeyValues{Key: strings.ToUpper(name), Value: values}
+	}
+	return res, nil
+}
+
+// value returns the static value or the result of the expression
+func (a *SetPropertyAction) value(ctx *Context) (string, error) {
+	if has(ctx.With, "value") {
+		return required[string](ctx.With, "value")
+	}
+	key, code, err := a.source(ctx.With)
+	if err != nil {
+		return "", err
+	}
+	env, err := ctx.Env()
+	if err != nil {
+		return "", err
+	}
+	var res interface{}
+	if prog, ok := ctx.Programs[key]; ok {
+		res, err = expr.Run(prog, env)
+	} else {
+		res, err = expr.Eval(code, env)
+	}
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", nil
+	}
+	return fmt.Sprint(res), nil
+}
+
+func (a *SetPropertyAction) Execute(ctx *Context) (ActionMessage, error) {
+	name, err := required[string](ctx.With, "property")
+	if err != nil {
+		return nil, err
+	}
+	property := ics.ComponentProperty(strings.ToUpper(name))
+	mode, err := optional[string](ctx.With, "mode", SetPropertyModeSet)
+	if err != nil {
+		return nil, err
+	}
+	escape, err := optional[bool](ctx.With, "escape", false)
+	if err != nil {
+		return nil, err
+	}
+	params, err := propertyParams(ctx.With)
+	if err != nil {
+		return nil, err
+	}
+	value, err := a.value(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if escape {
+		value = ics.ToText(value)
+	}
+
+	switch strings.ToLower(mode) {
+	case SetPropertyModeAdd:
+		ctx.Component.AddProperty(property, value, params...)
+	case SetPropertyModeSet:
+		// SetProperty only replaces the first value, remove all others
+		ctx.Component.SetProperty(property, value, params...)
+		found := false
+		for i := 0; i < len(ctx.Component.Properties); i++ {
+			if ctx.Component.Properties[i].IANAToken != string(property) {
+				continue
+			}
+			if !found {
+				found = true
+				continue
+			}
+			ctx.Component.Properties = append(ctx.Component.Properties[:i], ctx.Component.Properties[i+1:]...)
+			i--
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+	ctx.Logf("[actions/set-property] %s %s to '%s'", mode, property, value)
+	return nil, nil
+}
@@ -0,0 +1,123 @@
+package actions
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateExpression(t *testing.T) {
+	cases := map[string]string{
+		"":                                     `""`,
+		"plain":                                `"plain"`,
+		"[${Context.Room}] ${Event.Summary()}": `"[" + String(Context.Room) + "] " + String(Event.Summary())`,
+		"${ {'a': 1}.a }":                      `String( {'a': 1}.a )`,
+		`${ "}" }`:                             `String( "}" )`,
+		`${ x + "{" } y`:                       `String( x + "{" ) + " y"`,
+		`${ 'it\'s }' }`:                       `String( 'it\'s }' )`,
+		`${ "\"}" }`:                           `String( "\"}" )`,
+		"${ `}` }":                             "String( `}` )",
+	}
+	for tpl, expected := range cases {
+		code, err := templateExpression(tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Fatalf("expected %s for %q, got %s", expected, tpl, code)
+		}
+	}
+	for _, tpl := range []string{"${Context.Room", `${ "}" `, `${ '}\' }`} {
+		if _, err := templateExpression(tpl); err != ErrUnterminatedTemplate {
+			t.Fatalf("expected ErrUnterminatedTemplate for %q, got %v", tpl, err)
+		}
+	}
+}
+
+func TestSetProperty(t *testing.T) {
+	cases := []struct {
+		with     map[string]interface{}
+		expected []string
+	}{
+		{
+			with: map[string]interface{}{
+				"property": "description",
+				"$value":   "'[' + Context.Room + '] ' + Event.Description()",
+			},
+			expected: []string{"DESCRIPTION:[1.23] Lecture"},
+		},
+		{
+			with: map[string]interface{}{
+				"property": "X-ROOM",
+				"template": "Room ${Context.Room}",
+				"params":   map[string]interface{}{"x-tags": []interface{}{"a", "b"}},
+			},
+			expected: []string{"X-ROOM;X-TAGS=a,b:Room 1.23"},
+		},
+		{
+			with: map[string]interface{}{
+				"property": "SUMMARY",
+				"value":    "Vorlesung",
+				"params":   map[string]interface{}{"language": "de"},
+			},
+			expected: []string{"SUMMARY;LANGUAGE=de:Vorlesung"},
+		},
+		{
+			with:     map[string]interface{}{"property": "CATEGORIES", "value": "lecture"},
+			expected: []string{"CATEGORIES:lecture"},
+		},
+		{
+			with:     map[string]interface{}{"property": "CATEGORIES", "value": "lab", "mode": "add"},
+			expected: []string{"CATEGORIES:math", "CATEGORIES:physics", "CATEGORIES:lab"},
+		},
+		{
+			// the mode is case-insensitive like the enum of the schema
+			with:     map[string]interface{}{"property": "CATEGORIES", "value": "lecture", "mode": "SET"},
+			expected: []string{"CATEGORIES:lecture"},
+		},
+		{
+			with:     map[string]interface{}{"property": "CATEGORIES", "value": "lab", "mode": "Add"},
+			expected: []string{"CATEGORIES:math", "CATEGORIES:physics", "CATEGORIES:lab"},
+		},
+		{
+			with:     map[string]interface{}{"property": "COMMENT", "$value": "Context.Note", "escape": true},
+			expected: []string{`COMMENT:a\, b\nc`},
+		},
+	}
+	action := new(SetPropertyAction)
+	for i, c := range cases {
+		event := ics.NewEvent("a")
+		event.SetStartAt(time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC))
+		event.SetEndAt(time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC))
+		event.SetDescription("Lecture")
+		event.AddProperty(ics.ComponentPropertyCategories, "math")
+		event.AddProperty(ics.ComponentPropertyCategories, "physics")
+		programs, err := action.Compile(c.with)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &Context{
+			Component:     environ.NewComponent(event),
+			SharedContext: map[string]interface{}{"Room": "1.23", "Note": "a, b\nc"},
+			With:          c.with,
+			Programs:      programs,
+		}
+		if _, err = action.Execute(ctx); err != nil {
+			t.Fatalf("case %d: %v", i+1, err)
+		}
+		var lines []string
+		for _, line := range strings.Split(event.Serialize(), "\r\n") {
+			for _, e := range c.expected {
+				if strings.HasPrefix(line, strings.SplitN(strings.SplitN(e, ":", 2)[0], ";", 2)[0]) {
+					lines = append(lines, line)
+					break
+				}
+			}
+		}
+		if strings.Join(lines, "|") != strings.Join(c.expected, "|") {
+			t.Fatalf("case %d: expected %v, got %v", i+1, c.expected, lines)
+		}
+	}
+}
@@ -12,15 +12,19 @@ func (*ClearAlarmsAction) Identifier() string {
 	return "actions/clear-alarms"
 }
 
+func (*ClearAlarmsAction) Schema() *Schema {
+	return &Schema{}
+}
+
 func (*ClearAlarmsAction) Execute(ctx *Context) (ActionMessage, error) {
-	for i := len(ctx.Event.Properties) - 1; i >= 0; i-- {
-		if ctx.Event.Properties[i].IANAToken == string(ics.ComponentVAlarm) {
-			ctx.Event.Properties = append(ctx.Event.Properties[:i], ctx.Event.Properties[i+1:]...)
+	for i := len(ctx.Component.Properties) - 1; i >= 0; i-- {
+		if ctx.Component.Properties[i].IANAToken == string(ics.ComponentVAlarm) {
+			ctx.Component.Properties = append(ctx.Component.Properties[:i], ctx.Component.Properties[i+1:]...)
 		}
 	}
-	for i := len(ctx.Event.Components) - 1; i >= 0; i-- {
-		if _, ok := ctx.Event.Components[i].(*ics.VAlarm); ok {
-			ctx.Event.Components = append(ctx.Event.Components[:i], ctx.Event.Components[i+1:]...)
+	for i := len(ctx.Component.Components) - 1; i >= 0; i-- {
+		if _, ok := ctx.Component.Components[i].(*ics.VAlarm); ok {
+			ctx.Component.Components = append(ctx.Component.Components[:i], ctx.Component.Components[i+1:]...)
 		}
 	}
 	return nil, nil
@@ -34,6 +38,17 @@ func (*AddAlarmAction) Identifier() string {
 	return "actions/add-alarm"
 }
 
+func (*AddAlarmAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "action", Type: TypeString, Required: true, Enum: []string{"audio", "display", "email", "procedure"}},
+			{Name: "trigger", Type: TypeString, Required: true, Description: "e.g. -PT15M"},
+			{Name: "duration", Type: TypeString},
+			{Name: "repeat", Type: TypeString},
+		},
+	}
+}
+
 func (*AddAlarmAction) Execute(ctx *Context) (ActionMessage, error) {
 	action, err := required[string](ctx.With, "action")
 	if err != nil {
@@ -66,7 +81,7 @@ func (*AddAlarmAction) Execute(ctx *Context) (ActionMessage, error) {
 		return nil, fmt.Errorf("unknown action: %s", action)
 	}
 
-	alarm := ctx.Event.AddAlarm()
+	alarm := ctx.Component.AddAlarm()
 	alarm.SetAction(icsAction)
 	alarm.SetTrigger(trigger)
 
@@ -2,8 +2,10 @@ package actions
 
 import (
 	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
 	ics "github.com/darmiel/golang-ical"
-	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/environ"
 	"strings"
 )
 
@@ -13,6 +15,15 @@ func (*ClearAttendeesAction) Identifier() string {
 	return "actions/clear-attendees"
 }
 
+func (*ClearAttendeesAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "attendees", Type: TypeBool, Description: "clear attendees (default: true)"},
+			{Name: "organizer", Type: TypeBool, Description: "clear organizer (default: false)"},
+		},
+	}
+}
+
 func (*ClearAttendeesAction) Execute(ctx *Context) (ActionMessage, error) {
 	clearAttendees, err := optional[bool](ctx.With, "attendees", true)
 	if err != nil {
@@ -22,11 +33,11 @@ func (*ClearAttendeesAction) Execute(ctx *Context) (ActionMessage, error) {
 	if err != nil {
 		return nil, err
 	}
-	for i := len(ctx.Event.Properties) - 1; i >= 0; i-- {
-		doAttendees := clearAttendees && ctx.Event.Properties[i].IANAToken == string(ics.PropertyAttendee)
-		doOrganizer := clearOrganizer && ctx.Event.Properties[i].IANAToken == string(ics.PropertyOrganizer)
+	for i := len(ctx.Component.Properties) - 1; i >= 0; i-- {
+		doAttendees := clearAttendees && ctx.Component.Properties[i].IANAToken == string(ics.PropertyAttendee)
+		doOrganizer := clearOrganizer && ctx.Component.Properties[i].IANAToken == string(ics.PropertyOrganizer)
 		if doAttendees || doOrganizer {
-			ctx.Event.Properties = append(ctx.Event.Properties[:i], ctx.Event.Properties[i+1:]...)
+			ctx.Component.Properties = append(ctx.Component.Properties[:i], ctx.Component.Properties[i+1:]...)
 		}
 	}
 	return nil, nil
@@ -40,6 +51,18 @@ func (*AddAttendeeAction) Identifier() string {
 	return "actions/add-attendee"
 }
 
+func (*AddAttendeeAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "mail", Type: TypeString, Required: true},
+			{Name: "status", Type: TypeString, Enum: []string{
+				"needs-action", "accepted", "declined", "delegated", "completed", "in-process",
+			}},
+			{Name: "role", Type: TypeString, Enum: []string{"chair", "required", "optional", "non-participant"}},
+		},
+	}
+}
+
 func (*AddAttendeeAction) Execute(ctx *Context) (ActionMessage, error) {
 	mail, err := required[string](ctx.With, "mail")
 	if err != nil {
@@ -81,13 +104,73 @@ func (*AddAttendeeAction) Execute(ctx *Context) (ActionMessage, error) {
 		}
 	}
 
-	if ctx.Verbose {
-		fmt.Println("[actions/add-attendee] props:", props)
-	}
+	ctx.Logf("[actions/add-attendee] props: %v", props)
 
 	// check if event already has attendee
-	if !util.HasAttendee(ctx.Event, mail) {
-		ctx.Event.AddAttendee(mail, props...)
+	if !ctx.Component.HasAttendee(mail) {
+		ctx.Component.AddAttendee(mail, props...)
+	}
+	return nil, nil
+}
+
+// ---
+
+type RemoveAttendeeAction struct{}
+
+func (*RemoveAttendeeAction) Identifier() string {
+	return "actions/remove-attendee"
+}
+
+func (*RemoveAttendeeAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "mail", Type: TypeString},
+			{Name: "$mail", Type: TypeExpression},
+		},
+		OneOf: [][]string{{"mail"}, {"$mail"}},
+	}
+}
+
+// Compile compiles `$mail`
+func (*RemoveAttendeeAction) Compile(with map[string]interface{}) (map[string]*vm.Program, error) {
+	if !has(with, "$mail") {
+		return nil, nil
+	}
+	str, err := required[string](with, "$mail")
+	if err != nil {
+		return nil, err
+	}
+	prog, err := expr.Compile(str, expr.Env(new(environ.ExprEnvironment)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile '$mail': %v", err)
+	}
+	return map[string]*vm.Program{"$mail": prog}, nil
+}
+
+func (*RemoveAttendeeAction) Execute(ctx *Context) (ActionMessage, error) {
+	var mail string
+	if has(ctx.With, "$mail") {
+		env, err := ctx.Env()
+		if err != nil {
+			return nil, err
+		}
+		var res interface{}
+		if prog, ok := ctx.Programs["$mail"]; ok {
+			res, err = expr.Run(prog, env)
+		} else {
+			res, err = expr.Eval(fmt.Sprint(ctx.With["$mail"]), env)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mail = fmt.Sprint(res)
+	} else {
+		var err error
+		if mail, err = required[string](ctx.With, "mail"); err != nil {
+			return nil, err
+		}
 	}
+	removed := ctx.Component.RemoveAttendee(strings.TrimPrefix(mail, "mailto:"))
+	ctx.Logf("[actions/remove-attendee] removed %d attendee(s) (%s)", removed, mail)
 	return nil, nil
 }
@@ -0,0 +1,244 @@
+package actions
+
+import (
+	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"strings"
+	"unicode"
+)
+
+// DedupeReport is added to the debug output for every group of collapsed duplicates
+type DedupeReport struct {
+	Key string `json:"key"`
+	// Kept is the UID of the event which was kept
+	Kept string `json:"kept"`
+	// Removed are the UIDs of the removed duplicates
+	Removed []string `json:"removed"`
+}
+
+type CalendarDedupeAction struct{}
+
+func (*CalendarDedupeAction) Identifier() string {
+	return "calendar/dedupe"
+}
+
+func (*CalendarDedupeAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "by", Type: TypeString, Enum: []string{"uid", "time-summary"},
+				Description: "key of duplicates (default: uid)"},
+			{Name: "$key", Type: TypeExpression, Description: "expression returning the key of an event"},
+			{Name: "keep", Type: TypeString, Enum: []string{"first", "last"},
+				Description: "duplicate whose properties are kept (default: first)"},
+			{Name: "union", Type: TypeList, Description: "properties merged from all duplicates, e.g. [attendee, categories]"},
+		},
+	}
+}
+
+// CompileCalendar compiles `$key`
+func (*CalendarDedupeAction) CompileCalendar(with map[string]interface{}) (map[string]*vm.Program, error) {
+	if !has(with, "$key") {
+		return nil, nil
+	}
+	str, err := required[string](with, "$key")
+	if err != nil {
+		return nil, err
+	}
+	prog, err := expr.Compile(str, expr.Env(new(environ.ExprEnvironment)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile '$key': %v", err)
+	}
+	return map[string]*vm.Program{"$key": prog}, nil
+}
+
+// normalizeSummary removes everything except letters and digits, so "Team-Meeting " equals "team meeting"
+func normalizeSummary(summary string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(summary) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// dedupeKey returns the function which creates the key of an event.
+// Events with an empty key are never removed.
+func dedupeKey(ctx *CalendarContext) (func(c *environ.Component) (string, error), error) {
+	if has(ctx.With, "$key") {
+		if has(ctx.With, "by") {
+			return nil, fmt.Errorf("'by' and '$key' can't be used together")
+		}
+		return func(c *environ.Component) (string, error) {
+			env, err := environ.CreateExprEnvironment(c, ctx.SharedContext)
+			if err != nil {
+				return "", err
+			}
+			env.Params = ctx.Params
+			var res interface{}
+			if prog, ok := ctx.Programs["$key"]; ok {
+				res, err = expr.Run(prog, env)
+			} else {
+				res, err = expr.Eval(fmt.Sprint(ctx.With["$key"]), env)
+			}
+			if err != nil || res == nil {
+				return "", err
+			}
+			return fmt.Sprint(res), nil
+		}, nil
+	}
+	by, err := optional[string](ctx.With, "by", "uid")
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(by) {
+	case "uid":
+		return func(c *environ.Component) (string, error) {
+			key := c.Id()
+			if rid := c.GetProperty(ics.ComponentProperty(ics.PropertyRecurrenceId)); rid != nil {
+				key += "/" + rid.Value
+			}
+			return key, nil
+		}, nil
+	case "time-summary":
+		return func(c *environ.Component) (string, error) {
+			var start, end string
+			if t, err := c.GetTime(ics.ComponentPropertyDtStart); err == nil {
+				start = t.UTC().Format("20060102T150405Z")
+			}
+			if t, err := c.GetTime(ics.ComponentPropertyDtEnd); err == nil {
+				end = t.UTC().Format("20060102T150405Z")
+			}
+			summary := ""
+			if p := c.GetProperty(ics.ComponentPropertySummary); p != nil {
+				summary = normalizeSummary(p.Value)
+			}
+			return start + "/" + end + "/" + summary, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown dedupe key: %s", by)
+}
+
+// unionProperties adds the values of the properties of src which dst doesn't have.
+// Attendees are compared by mail, categories by their comma separated values.
+func unionProperties(dst, src *environ.Component, names []string) {
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		switch name {
+		case string(ics.ComponentPropertyAttendee):
+			for _, a := range src.Attendees() {
+				if !dst.HasAttendee(a.Email()) {
+					dst.Properties = append(dst.Properties, a.IANAProperty)
+				}
+			}
+		case string(ics.ComponentPropertyCategories):
+			var categories []string
+			seen := make(map[string]bool)
+			for _, c := range []*environ.Component{dst, src} {
+				for _, p := range c.Properties {
+					if p.IANAToken != name {
+						continue
+					}
+					for _, category := range strings.Split(p.Value, ",") {
+						category = strings.TrimSpace(category)
+						if category != "" && !seen[strings.ToLower(category)] {
+							seen[strings.ToLower(category)] = true
+							categories = append(categories, category)
+						}
+					}
+				}
+			}
+			if len(categories) > 0 {
+				dst.SetProperty(ics.ComponentPropertyCategories, strings.Join(categories, ","))
+			}
+		default:
+			for _, p := range src.Properties {
+				if p.IANAToken != name {
+					continue
+				}
+				exists := false
+				for _, q := range dst.Properties {
+					if q.IANAToken == name && q.Value == p.Value {
+						exists = true
+						break
+					}
+				}
+				if !exists {
+					dst.Properties = append(dst.Properties, p)
+				}
+			}
+		}
+	}
+}
+
+// ExecuteCalendar removes events with the same key (by default the UID and RECURRENCE-ID) except one.
+// The properties in `union` of the removed duplicates are merged into the kept event.
+func (*CalendarDedupeAction) ExecuteCalendar(ctx *CalendarContext) error {
+	key, err := dedupeKey(ctx)
+	if err != nil {
+		return err
+	}
+	keep, err := optional[string](ctx.With, "keep", "first")
+	if err != nil {
+		return err
+	}
+	keepLast := strings.ToLower(keep) == "last"
+	if !keepLast && strings.ToLower(keep) != "first" {
+		return fmt.Errorf("unknown keep: %s", keep)
+	}
+	union, err := strArray(ctx.With, "union", nil)
+	if err != nil {
+		return err
+	}
+
+	var (
+		res     []ics.Component
+		reports []*DedupeReport
+		// index of the kept event in res and its report
+		kept  = make(map[string]int)
+		byKey = make(map[string]*DedupeReport)
+	)
+	for _, c := range ctx.Calendar.Components {
+		component := environ.NewComponent(c)
+		if component == nil {
+			res = append(res, c)
+			continue
+		}
+		k, err := key(component)
+		if err != nil {
+			return fmt.Errorf("cannot create key of %s: %v", component.Id(), err)
+		}
+		idx, seen := kept[k]
+		if k == "" || !seen {
+			kept[k] = len(res)
+			res = append(res, c)
+			continue
+		}
+
+		report := byKey[k]
+		if report == nil {
+			report = &DedupeReport{Key: k, Kept: environ.NewComponent(res[idx]).Id()}
+			byKey[k] = report
+			reports = append(reports, report)
+		}
+		if keepLast {
+			// the new event replaces the kept event at its position
+			unionProperties(component, environ.NewComponent(res[idx]), union)
+			report.Removed = append(report.Removed, report.Kept)
+			report.Kept = component.Id()
+			res[idx] = c
+		} else {
+			unionProperties(environ.NewComponent(res[idx]), component, union)
+			report.Removed = append(report.Removed, component.Id())
+		}
+		ctx.Logf("[calendar/dedupe] removed duplicate %s", k)
+	}
+	ctx.Calendar.Components = res
+	for _, report := range reports {
+		ctx.debug(report)
+	}
+	return nil
+}
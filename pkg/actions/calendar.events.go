@@ -0,0 +1,217 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/environ"
+	"sort"
+	"strings"
+)
+
+var ErrNegativeLimit = errors.New("'max' must not be negative")
+
+// splitComponents returns all events (including tasks and journal entries) and all other components
+func splitComponents(cal *ics.Calendar) (events []*environ.Component, others []ics.Component, originals []ics.Component) {
+	for _, c := range cal.Components {
+		if component := environ.NewComponent(c); component != nil {
+			events = append(events, component)
+			originals = append(originals, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+	return
+}
+
+type CalendarSetPropertyAction struct{}
+
+func (*CalendarSetPropertyAction) Identifier() string {
+	return "calendar/set-property"
+}
+
+func (*CalendarSetPropertyAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "property", Type: TypeString, Required: true},
+			{Name: "value", Type: TypeString},
+			{Name: "$value", Type: TypeExpression},
+		},
+		OneOf: [][]string{{"value"}, {"$value"}},
+	}
+}
+
+// CompileCalendar compiles `$value`
+func (*CalendarSetPropertyAction) CompileCalendar(with map[string]interface{}) (map[string]*vm.Program, error) {
+	if !has(with, "$value") {
+		return nil, nil
+	}
+	str, err := required[string](with, "$value")
+	if err != nil {
+		return nil, err
+	}
+	prog, err := expr.Compile(str, expr.Env(new(environ.CalendarEnvironment)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile '$value': %v", err)
+	}
+	return map[string]*vm.Program{"$value": prog}, nil
+}
+
+func (*CalendarSetPropertyAction) ExecuteCalendar(ctx *CalendarContext) error {
+	property, err := required[string](ctx.With, "property")
+	if err != nil {
+		return err
+	}
+	var value string
+	if has(ctx.With, "$value") {
+		env := ctx.Env()
+		var res interface{}
+		if prog, ok := ctx.Programs["$value"]; ok {
+			res, err = expr.Run(prog, env)
+		} else {
+			res, err = expr.Eval(fmt.Sprint(ctx.With["$value"]), env)
+		}
+		if err != nil {
+			return err
+		}
+		value = fmt.Sprint(res)
+	} else if value, err = required[string](ctx.With, "value"); err != nil {
+		return err
+	}
+	property = strings.ToUpper(property)
+	util.SetCalendarProperty(ctx.Calendar, property, value, map[string][]string{})
+	ctx.Logf("[calendar/set-property] Set (%s) to '%s'", property, value)
+	return nil
+}
+
+// ---
+
+type CalendarSortAction struct{}
+
+func (*CalendarSortAction) Identifier() string {
+	return "calendar/sort"
+}
+
+func (*CalendarSortAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "by", Type: TypeString, Enum: []string{"start", "end", "summary", "uid"}},
+			{Name: "order", Type: TypeString, Enum: []string{"asc", "desc"}},
+		},
+	}
+}
+
+// ExecuteCalendar sorts all events by `by` (start, end, summary or uid).
+// Other components (e.g. VTIMEZONE) are moved before the events.
+func (*CalendarSortAction) ExecuteCalendar(ctx *CalendarContext) error {
+	by, err := optional[string](ctx.With, "by", "start")
+	if err != nil {
+		return err
+	}
+	order, err := optional[string](ctx.With, "order", "asc")
+	if err != nil {
+		return err
+	}
+	var key func(c *environ.Component) string
+	switch strings.ToLower(by) {
+	case "start", "end":
+		prop := ics.ComponentPropertyDtStart
+		if strings.ToLower(by) == "end" {
+			prop = ics.ComponentPropertyDtEnd
+		}
+		key = func(c *environ.Component) string {
+			t, err := c.GetTime(prop)
+			if err != nil {
+				return ""
+			}
+			return t.UTC().Format("20060102T150405")
+		}
+	case "summary":
+		key = func(c *environ.Component) string {
+			if p := c.GetProperty(ics.ComponentPropertySummary); p != nil {
+				return p.Value
+			}
+			return ""
+		}
+	case "uid":
+		key = func(c *environ.Component) string {
+			return c.Id()
+		}
+	default:
+		return fmt.Errorf("unknown sort key: %s", by)
+	}
+	desc := strings.ToLower(order) == "desc"
+	if !desc && strings.ToLower(order) != "asc" {
+		return fmt.Errorf("unknown order: %s", order)
+	}
+
+	events, others, originals := splitComponents(ctx.Calendar)
+	keys := make([]string, len(events))
+	for i, e := range events {
+		keys[i] = key(e)
+	}
+	idx := make([]int, len(events))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		if desc {
+			return keys[idx[i]] > keys[idx[j]]
+		}
+		return keys[idx[i]] < keys[idx[j]]
+	})
+	res := others
+	for _, i := range idx {
+		res = append(res, originals[i])
+	}
+	ctx.Calendar.Components = res
+	return nil
+}
+
+// ---
+
+type CalendarLimitAction struct{}
+
+func (*CalendarLimitAction) Identifier() string {
+	return "calendar/limit"
+}
+
+func (*CalendarLimitAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "max", Type: TypeInt, Required: true},
+		},
+	}
+}
+
+// ExecuteCalendar removes all events after the first `max` events
+func (*CalendarLimitAction) ExecuteCalendar(ctx *CalendarContext) error {
+	if !has(ctx.With, "max") {
+		return errors.New("'max' required.")
+	}
+	max, err := integer(ctx.With, "max", 0)
+	if err != nil {
+		return err
+	}
+	if max < 0 {
+		return ErrNegativeLimit
+	}
+	var (
+		res   []ics.Component
+		count int
+	)
+	for _, c := range ctx.Calendar.Components {
+		if environ.NewComponent(c) != nil {
+			if count >= max {
+				continue
+			}
+			count++
+		}
+		res = append(res, c)
+	}
+	ctx.Calendar.Components = res
+	return nil
+}
@@ -0,0 +1,72 @@
+package actions
+
+import (
+	"github.com/antonmedv/expr/vm"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"io"
+)
+
+// calendarActions can be used in before and after flows, see RegisterCalendar, FindCalendar and ListCalendar
+var calendarActions = []CalendarAction{
+	new(CtxSetAction),
+	new(CalendarSetPropertyAction),
+	new(CalendarDedupeAction),
+	new(CalendarSortAction),
+	new(CalendarLimitAction),
+}
+
+// FindCalendar returns the calendar action with the identifier or nil
+func FindCalendar(identifier string) CalendarAction {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return findIn(calendarActions, identifier)
+}
+
+// CalendarAction is an action which runs once for the whole calendar
+type CalendarAction interface {
+	Identifier() string
+	ExecuteCalendar(ctx *CalendarContext) error
+}
+
+// CalendarCompiler is implemented by calendar actions which evaluate expressions from their `with` values.
+// The compiled programs are passed back to ExecuteCalendar in CalendarContext.Programs.
+type CalendarCompiler interface {
+	CompileCalendar(with map[string]interface{}) (map[string]*vm.Program, error)
+}
+
+type CalendarContext struct {
+	Calendar      *ics.Calendar
+	SharedContext map[string]interface{}
+	With          map[string]interface{}
+	Verbose       bool
+	// Output receives verbose messages (os.Stdout if nil)
+	Output io.Writer
+	// Programs contains the pre-compiled expressions (if the action is a CalendarCompiler)
+	Programs map[string]*vm.Program
+	// Params contains the values of the profile parameters
+	Params map[string]interface{}
+	// Debug adds a message to the debug output (can be nil)
+	Debug func(message interface{})
+}
+
+// Logf writes a verbose message to Output if Verbose is enabled
+func (c *CalendarContext) Logf(format string, args ...interface{}) {
+	if c.Verbose {
+		logf(c.Output, format, args...)
+	}
+}
+
+// debug adds a message to the debug output if enabled
+func (c *CalendarContext) debug(message interface{}) {
+	if c.Debug != nil {
+		c.Debug(message)
+	}
+}
+
+// Env creates the expression environment for the calendar
+func (c *CalendarContext) Env() *environ.CalendarEnvironment {
+	env := environ.CreateCalendarEnvironment(c.Calendar, c.SharedContext)
+	env.Params = c.Params
+	return env
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
 	"github.com/darmiel/ralf/internal/util"
 	"github.com/darmiel/ralf/pkg/environ"
 	"strings"
@@ -15,6 +16,16 @@ func (c *CtxSetAction) Identifier() string {
 	return "ctx/set"
 }
 
+func (c *CtxSetAction) Schema() *Schema {
+	return &Schema{
+		Parameters: []*Parameter{
+			{Name: "$overwrite", Type: TypeBool, Description: "overwrite existing values"},
+		},
+		// values to set, dynamic values start with "$"
+		Dynamic: true,
+	}
+}
+
 var (
 	ErrKeyInSharedContext = errors.New("key already in shared context. set $overwrite to true to overwrite")
 	ErrNotString          = errors.New("dynamic values must be of type string")
@@ -25,43 +36,111 @@ type ctxSetExprEnv struct {
 	With util.NamedValues
 }
 
-func (c *CtxSetAction) Execute(ctx *Context) (ActionMessage, error) {
-	overwrite, err := optional(ctx.With, "$overwrite", false)
+// ctxSetCalendarEnv is used for dynamic values in before and after flows
+type ctxSetCalendarEnv struct {
+	environ.CalendarEnvironment
+	With util.NamedValues
+}
+
+func (c *CtxSetAction) compile(with map[string]interface{}, env interface{}) (map[string]*vm.Program, error) {
+	programs := make(map[string]*vm.Program)
+	for k, v := range with {
+		if !strings.HasPrefix(k, "$") || k == "$overwrite" {
+			continue
+		}
+		str, ok := v.(string)
+		if !ok {
+			return nil, ErrNotString
+		}
+		prog, err := expr.Compile(str, expr.Env(env))
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile '%s': %v", k, err)
+		}
+		programs[k] = prog
+	}
+	return programs, nil
+}
+
+// Compile compiles all dynamic values (keys starting with "$")
+func (c *CtxSetAction) Compile(with map[string]interface{}) (map[string]*vm.Program, error) {
+	return c.compile(with, new(ctxSetExprEnv))
+}
+
+// CompileCalendar compiles all dynamic values (keys starting with "$") for before and after flows
+func (c *CtxSetAction) CompileCalendar(with map[string]interface{}) (map[string]*vm.Program, error) {
+	return c.compile(with, new(ctxSetCalendarEnv))
+}
+
+// set sets all values from with in the shared context.
+// env is only called if there are dynamic values, logf writes verbose messages.
+func (c *CtxSetAction) set(
+	with, sharedContext map[string]interface{},
+	programs map[string]*vm.Program,
+	logf func(format string, args ...interface{}),
+	env func() (interface{}, error),
+) error {
+	overwrite, err := optional(with, "$overwrite", false)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for k, v := range ctx.With {
+	for key, v := range with {
+		// $overwrite is an option and not a value
+		if key == "$overwrite" {
+			continue
+		}
+		k := key
 		dynamic := strings.HasPrefix(k, "$")
 		if dynamic {
 			k = strings.TrimLeft(k, "$")
 			// for dynamic values, the value must be a string.
 			if _, ok := v.(string); !ok {
-				return nil, ErrNotString
+				return ErrNotString
 			}
 		}
 		// if already in shared context, and we don't want to overwrite, panic
-		if _, ok := ctx.SharedContext[k]; ok && !overwrite {
-			return nil, ErrKeyInSharedContext
+		if _, ok := sharedContext[k]; ok && !overwrite {
+			return ErrKeyInSharedContext
 		}
 		if dynamic {
-			defaultEnv, err := environ.CreateExprEnvironmentFromEvent(ctx.Event, ctx.SharedContext)
+			e, err := env()
 			if err != nil {
-				return nil, err
+				return err
 			}
-			env := ctxSetExprEnv{
-				ExprEnvironment: *defaultEnv,
-				With:            ctx.With,
+			var eval interface{}
+			if prog, ok := programs[key]; ok {
+				eval, err = expr.Run(prog, e)
+			} else {
+				eval, err = expr.Eval(v.(string), e)
 			}
-			eval, err := expr.Eval(v.(string), &env)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			v = eval
 		}
-		ctx.SharedContext[k] = v
-		if ctx.Verbose {
-			fmt.Printf("[ctx/set] Set (%s) to '%+v'\n", k, v)
-		}
+		sharedContext[k] = v
+		logf("[ctx/set] Set (%s) to '%+v'", k, v)
 	}
-	return nil, nil
+	return nil
+}
+
+func (c *CtxSetAction) Execute(ctx *Context) (ActionMessage, error) {
+	return nil, c.set(ctx.With, ctx.SharedContext, ctx.Programs, ctx.Logf, func() (interface{}, error) {
+		defaultEnv, err := ctx.Env()
+		if err != nil {
+			return nil, err
+		}
+		return &ctxSetExprEnv{
+			ExprEnvironment: *defaultEnv,
+			With:            ctx.With,
+		}, nil
+	})
+}
+
+func (c *CtxSetAction) ExecuteCalendar(ctx *CalendarContext) error {
+	return c.set(ctx.With, ctx.SharedContext, ctx.Programs, ctx.Logf, func() (interface{}, error) {
+		return &ctxSetCalendarEnv{
+			CalendarEnvironment: *ctx.Env(),
+			With:                ctx.With,
+		}, nil
+	})
 }
@@ -6,8 +6,16 @@ func (fia *FilterInAction) Identifier() string {
 	return "filters/filter-in"
 }
 
+func (fia *FilterInAction) Schema() *Schema {
+	return filterSchema
+}
+
 ///
 
-func (fia *FilterInAction) Execute(_ *Context) (ActionMessage, error) {
-	return new(FilterInActionMessage), nil
+func (fia *FilterInAction) Execute(ctx *Context) (ActionMessage, error) {
+	final, err := optional[bool](ctx.With, "final", false)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterInActionMessage{Final: final}, nil
 }
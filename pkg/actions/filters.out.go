@@ -6,8 +6,16 @@ func (foa *FilterOutAction) Identifier() string {
 	return "filters/filter-out"
 }
 
+func (foa *FilterOutAction) Schema() *Schema {
+	return filterSchema
+}
+
 ///
 
-func (foa *FilterOutAction) Execute(_ *Context) (ActionMessage, error) {
-	return new(FilterOutActionMessage), nil
+func (foa *FilterOutAction) Execute(ctx *Context) (ActionMessage, error) {
+	final, err := optional[bool](ctx.With, "final", false)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterOutActionMessage{Final: final}, nil
 }
@@ -0,0 +1,92 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrDuplicateAction = errors.New("action already registered")
+
+// registryMu guards eventActions and calendarActions
+var registryMu sync.RWMutex
+
+// Register adds an action which can be used in flows.
+// If the action also implements CalendarAction, it can be used in before and after flows as well.
+func Register(act Action) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if findIn(eventActions, act.Identifier()) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateAction, act.Identifier())
+	}
+	cal, isCalendar := act.(CalendarAction)
+	if isCalendar && findIn(calendarActions, cal.Identifier()) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateAction, cal.Identifier())
+	}
+	eventActions = append(eventActions, act)
+	if isCalendar {
+		calendarActions = append(calendarActions, cal)
+	}
+	return nil
+}
+
+// RegisterCalendar adds an action which can only be used in before and after flows
+func RegisterCalendar(act CalendarAction) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if findIn(calendarActions, act.Identifier()) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateAction, act.Identifier())
+	}
+	calendarActions = append(calendarActions, act)
+	return nil
+}
+
+// List returns all registered actions
+func List() []Action {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Action(nil), eventActions...)
+}
+
+// ListCalendar returns all registered actions which can be used in before and after flows
+func ListCalendar() []CalendarAction {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]CalendarAction(nil), calendarActions...)
+}
+
+// Actions returns all registered actions by their identifier.
+//
+// Deprecated: the registry is no longer an exported variable, use List, Find or Register instead.
+func Actions() map[string]Action {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	res := make(map[string]Action, len(eventActions))
+	for _, act := range eventActions {
+		res[act.Identifier()] = act
+	}
+	return res
+}
+
+// CalendarActions returns all registered actions which can be used in before and after flows by their identifier.
+//
+// Deprecated: the registry is no longer an exported variable, use ListCalendar, FindCalendar or RegisterCalendar instead.
+func CalendarActions() map[string]CalendarAction {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	res := make(map[string]CalendarAction, len(calendarActions))
+	for _, act := range calendarActions {
+		res[act.Identifier()] = act
+	}
+	return res
+}
+
+func findIn[T interface{ Identifier() string }](acts []T, identifier string) T {
+	for _, act := range acts {
+		if act.Identifier() == identifier {
+			return act
+		}
+	}
+	var n T
+	return n
+}
@@ -0,0 +1,86 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+)
+
+type roomLookupAction struct{}
+
+func (*roomLookupAction) Identifier() string {
+	return "company/room-lookup"
+}
+
+func (*roomLookupAction) Schema() *Schema {
+	return &Schema{}
+}
+
+func (*roomLookupAction) Execute(_ *Context) (ActionMessage, error) {
+	return nil, nil
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register(new(roomLookupAction)); err != nil {
+		t.Fatal(err)
+	}
+	if Find("company/room-lookup") == nil {
+		t.Fatal("expected registered action to be found")
+	}
+	if FindCalendar("company/room-lookup") != nil {
+		t.Fatal("expected action not to be a calendar action")
+	}
+	if err := Register(new(roomLookupAction)); !errors.Is(err, ErrDuplicateAction) {
+		t.Fatalf("expected ErrDuplicateAction, got %v", err)
+	}
+	if err := Register(new(FilterOutAction)); !errors.Is(err, ErrDuplicateAction) {
+		t.Fatalf("expected ErrDuplicateAction for built-in action, got %v", err)
+	}
+	if err := RegisterCalendar(new(CalendarSortAction)); !errors.Is(err, ErrDuplicateAction) {
+		t.Fatalf("expected ErrDuplicateAction for built-in calendar action, got %v", err)
+	}
+}
+
+// noSchemaAction doesn't implement SchemaProvider
+type noSchemaAction struct{}
+
+func (*noSchemaAction) Identifier() string {
+	return "company/no-schema"
+}
+
+func (*noSchemaAction) Execute(_ *Context) (ActionMessage, error) {
+	return nil, nil
+}
+
+func TestSchemaOf(t *testing.T) {
+	if SchemaOf(new(noSchemaAction)) != nil {
+		t.Fatal("expected no schema for an action without Schema()")
+	}
+	if SchemaOf(new(SetPropertyAction)) == nil {
+		t.Fatal("expected schema of built-in action")
+	}
+	if err := Register(new(noSchemaAction)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListReturnsCopy(t *testing.T) {
+	list := List()
+	list[0] = new(noSchemaAction)
+	if List()[0] == list[0] {
+		t.Fatal("expected List to return a copy of the registered actions")
+	}
+}
+
+func TestDeprecatedActions(t *testing.T) {
+	acts := Actions()
+	if acts[new(SetPropertyAction).Identifier()] == nil || len(acts) != len(List()) {
+		t.Fatalf("expected all registered actions, got %d of %d", len(acts), len(List()))
+	}
+	delete(acts, new(SetPropertyAction).Identifier())
+	if Find(new(SetPropertyAction).Identifier()) == nil || Actions()[new(SetPropertyAction).Identifier()] == nil {
+		t.Fatal("expected Actions to return a copy of the registry")
+	}
+	if cal := CalendarActions(); len(cal) != len(ListCalendar()) {
+		t.Fatalf("expected all calendar actions, got %d of %d", len(cal), len(ListCalendar()))
+	}
+}
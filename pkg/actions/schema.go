@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// types of action parameters
+const (
+	TypeString = "string"
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypeList   = "list"
+	TypeAny    = "any"
+	// TypeExpression is a string which is evaluated as an expression
+	TypeExpression = "expression"
+)
+
+// Parameter describes a single `with` value of an action
+type Parameter struct {
+	Name        string
+	Type        string
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+// Schema describes all `with` values of an action
+type Schema struct {
+	Parameters []*Parameter
+	// OneOf contains groups of parameter names. Exactly one of the groups must be set completely.
+	OneOf [][]string
+	// Dynamic allows additional parameters (e.g. ctx/set)
+	Dynamic bool
+}
+
+// SchemaProvider is implemented by actions which describe their `with` values.
+// The values of actions without a schema are not checked.
+type SchemaProvider interface {
+	Schema() *Schema
+}
+
+// SchemaOf returns the schema of an action or nil if the action doesn't provide one
+func SchemaOf(act interface{}) *Schema {
+	if p, ok := act.(SchemaProvider); ok {
+		return p.Schema()
+	}
+	return nil
+}
+
+// Find returns the parameter with the name or nil
+func (s *Schema) Find(name string) *Parameter {
+	for _, p := range s.Parameters {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Validate checks the `with` values of an action and returns every problem.
+// skip is called for every value and can be used to ignore values which are only known at runtime.
+func (s *Schema) Validate(with map[string]interface{}, skip func(value interface{}) bool) (errs []error) {
+	keys := make([]string, 0, len(with))
+	for k := range with {
+		keys = append(keys, k)
+	}
+	// sort keys to always report problems in the same order
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := s.Find(k)
+		if p == nil {
+			if !s.Dynamic {
+				errs = append(errs, fmt.Errorf("unknown parameter '%s'", k))
+			}
+			continue
+		}
+		if skip != nil && skip(with[k]) {
+			continue
+		}
+		if err := p.check(with[k]); err != nil {
+			errs = append(errs, fmt.Errorf("parameter '%s' %v", k, err))
+		}
+	}
+	for _, p := range s.Parameters {
+		if p.Required && !has(with, p.Name) {
+			errs = append(errs, fmt.Errorf("missing required parameter '%s'", p.Name))
+		}
+	}
+	if len(s.OneOf) > 0 {
+		complete := 0
+		for _, group := range s.OneOf {
+			set := true
+			for _, name := range group {
+				set = set && has(with, name)
+			}
+			if set {
+				complete++
+			}
+		}
+		if complete != 1 {
+			alternatives := make([]string, len(s.OneOf))
+			for i, group := range s.OneOf {
+				alternatives[i] = "'" + strings.Join(group, "' and '") + "'"
+			}
+			errs = append(errs, fmt.Errorf("requires exactly one of %s", strings.Join(alternatives, " or ")))
+		}
+	}
+	return
+}
+
+// check checks the type and the allowed values of a parameter
+func (p *Parameter) check(value interface{}) error {
+	ok := true
+	switch p.Type {
+	case TypeString, TypeExpression:
+		_, ok = value.(string)
+	case TypeBool:
+		_, ok = value.(bool)
+	case TypeInt:
+		_, err := integer(map[string]interface{}{p.Name: value}, p.Name, 0)
+		ok = err == nil
+	case TypeList:
+		_, ok = value.([]interface{})
+	}
+	if !ok {
+		return fmt.Errorf("must be of type %s, got %T", p.Type, value)
+	}
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	for _, e := range p.Enum {
+		if strings.EqualFold(e, fmt.Sprint(value)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s, got '%v'", strings.Join(p.Enum, ", "), value)
+}
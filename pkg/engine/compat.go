@@ -0,0 +1,82 @@
+package engine
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"os"
+)
+
+// RunMultiFlows compiles the flows and runs them for an event.
+//
+// Deprecated: compile the flows once using Compile or CompileProfile and use RunPlan.
+func (c *ContextFlow) RunMultiFlows(event *ics.VEvent, flows model.Flows) (actions.ActionMessage, error) {
+	plan, err := Compile(flows)
+	if err != nil {
+		return nil, err
+	}
+	return c.RunPlan(environ.NewComponent(event), plan)
+}
+
+// RunMultiFlowsRecursive compiles the flows and runs them for an event.
+// fact is set to the verdict of the event.
+//
+// Deprecated: compile the flows once using Compile or CompileProfile and use ContextFlow.RunPlan.
+func RunMultiFlowsRecursive(
+	fact *actions.ActionMessage,
+	event *ics.VEvent,
+	flows model.Flows,
+	debugMessages *[]interface{},
+	verbose, enableDebugFlow bool,
+	sharedContext util.NamedValues,
+) error {
+	plan, err := Compile(flows)
+	if err != nil {
+		return err
+	}
+	r := legacyRunner(plan, event, verbose, enableDebugFlow, sharedContext)
+	if debugMessages != nil {
+		r.debugMessages = debugMessages
+	}
+	r.fact = *fact
+	err = r.runFlows(flows, nil)
+	*fact = r.fact
+	return err
+}
+
+// RunSingleFlow compiles a single flow and runs it for an event.
+// Child flows are not executed but returned as QueueFlowsExecutionMessage.
+//
+// Deprecated: compile the flows once using Compile or CompileProfile and use ContextFlow.RunPlan.
+func RunSingleFlow(
+	event *ics.VEvent,
+	flow model.Flow,
+	verbose, enableDebugFlow bool,
+	sharedContext util.NamedValues,
+) (ExecutionMessage, error) {
+	plan, err := Compile(model.Flows{flow})
+	if err != nil {
+		return nil, err
+	}
+	return legacyRunner(plan, event, verbose, enableDebugFlow, sharedContext).runFlow(flow, nil)
+}
+
+// legacyRunner creates a runner without limits for the deprecated functions
+func legacyRunner(plan *Plan, event *ics.VEvent, verbose, enableDebug bool, sharedContext util.NamedValues) *runner {
+	if sharedContext == nil {
+		sharedContext = make(util.NamedValues)
+	}
+	return &runner{
+		plan:          plan,
+		verbose:       verbose,
+		enableDebug:   enableDebug,
+		output:        os.Stdout,
+		event:         environ.NewComponent(event),
+		sharedContext: sharedContext,
+		debugMessages: new([]interface{}),
+		// filter everything in by default
+		fact: new(actions.FilterInActionMessage),
+	}
+}
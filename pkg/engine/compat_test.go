@@ -0,0 +1,53 @@
+package engine
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompatWrappers(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - debug: '$ "checking " + Event.Summary()'
+  - if: 'Event.Summary() == "Sports"'
+    then:
+      - do: filters/filter-out
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	cp := &ContextFlow{Profile: profile, EnableDebug: true}
+	fact, err := cp.RunMultiFlows(newTestEvent("a", "Sports", start), profile.Flows)
+	if err != nil || !isFilteredOut(fact) {
+		t.Fatalf("RunMultiFlows: expected event to be filtered out, got %v (%v)", fact, err)
+	}
+	if len(cp.Debugs) != 1 || cp.Debugs[0] != "checking Sports" {
+		t.Fatalf("RunMultiFlows: expected debug message, got %v", cp.Debugs)
+	}
+
+	var debugs []interface{}
+	fact = new(actions.FilterInActionMessage)
+	err = RunMultiFlowsRecursive(&fact, newTestEvent("b", "Math", start), profile.Flows, &debugs, false, true, util.NamedValues{})
+	if err != nil || isFilteredOut(fact) || len(debugs) != 1 {
+		t.Fatalf("RunMultiFlowsRecursive: expected event to be kept with a debug message, got %v, %v (%v)", fact, debugs, err)
+	}
+
+	msg, err := RunSingleFlow(newTestEvent("c", "Sports", start), profile.Flows[1], false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, ok := msg.(*QueueFlowsExecutionMessage)
+	if !ok || len(queue.Flows) != 1 {
+		t.Fatalf("RunSingleFlow: expected the then flows to be queued, got %+v", msg)
+	}
+	if _, err = RunSingleFlow(ics.NewEvent("d"), &model.ActionFlow{FlowIdentifier: "unknown/action"}, false, false, nil); err == nil {
+		t.Fatal("RunSingleFlow: expected error for unknown action")
+	}
+}
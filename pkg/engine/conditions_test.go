@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditionGroups(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - if:
+      all:
+        - 'Event.Summary() startsWith "CS"'
+        - any:
+            - 'Event.Summary() endsWith "1"'
+            - not: 'Event.Summary() contains "Lab"'
+    then:
+      - return: keep
+  - unless: 'Event.Summary() == "Sports"'
+    then:
+      - do: filters/filter-out
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	for _, summary := range []string{"CS101", "CS Lab", "CS Lab 1", "CS Lecture", "Math", "Sports"} {
+		cal.AddVEvent(newTestEvent(summary, summary, start))
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	var uids []string
+	for _, e := range cal.Events() {
+		uids = append(uids, e.Id())
+	}
+	if expected := "CS101,CS Lab 1,CS Lecture,Sports"; strings.Join(uids, ",") != expected {
+		t.Fatalf("expected %s, got %v", expected, uids)
+	}
+}
+
+func TestConditionShortCircuit(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - if: [ 'true', 'Context.missing > 1' ]
+    op: or
+    then: []
+  - if: [ 'false', 'Context.missing > 1' ]
+    then: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "a", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	// the second conditions would fail if they were evaluated
+	cp := &ContextFlow{Profile: profile, EnableTrace: true}
+	if err = ModifyCalendar(cp, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	steps := cp.Traces[0].Steps
+	if len(steps[0].Conditions) != 1 || !*steps[0].Result {
+		t.Fatalf("expected or to stop at the first true condition, got %+v", steps[0].Conditions)
+	}
+	if len(steps[1].Conditions) != 1 || *steps[1].Result {
+		t.Fatalf("expected and to stop at the first false condition, got %+v", steps[1].Conditions)
+	}
+}
+
+func TestInvalidConditionFlow(t *testing.T) {
+	for _, flow := range []string{
+		"- if: 'true'\n    unless: 'false'\n    then: []",
+		"- if: { any: [] }\n    then: []",
+	} {
+		profile, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nflows:\n  " + flow + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CompileProfile(profile)
+		if !errors.Is(err, ErrInvalidCondition) && !errors.Is(err, model.ErrInvalidCondition) {
+			t.Fatalf("expected invalid condition for %q, got %v", flow, err)
+		}
+	}
+}
+
+func TestEmptyCondition(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - if: []
+    then:
+      - do: filters/filter-out
+    else:
+      - do: actions/set-property
+        with:
+          property: location
+          value: else
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "a", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 1 || events[0].GetProperty(ics.ComponentPropertyLocation).Value != "else" {
+		t.Fatal("expected an empty condition to run the else branch")
+	}
+}
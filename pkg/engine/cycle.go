@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/antonmedv/expr"
@@ -9,88 +10,249 @@ import (
 	"github.com/darmiel/ralf/pkg/actions"
 	"github.com/darmiel/ralf/pkg/environ"
 	"github.com/darmiel/ralf/pkg/model"
-	"strings"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
 )
 
 type ContextFlow struct {
 	*model.Profile
+	// Context is the shared context of the calendar.
+	// Values set in before flows are copied to the shared context of every event.
 	Context     map[string]interface{}
 	EnableDebug bool
 	Verbose     bool
 	Debugs      []interface{}
+	// Output receives debug messages and verbose messages of actions (os.Stdout if nil)
+	Output io.Writer
+	output *syncWriter
+	// EnableTrace records every flow which ran for an event in Traces
+	EnableTrace bool
+	Traces      []*EventTrace
+	// Workers is the number of events processed at once by ModifyCalendar.
+	// Values <= 1 process events sequentially.
+	Workers int
+	// Params contains the values of the profile parameters
+	Params map[string]interface{}
+	// Limits restrict the execution of flows
+	Limits Limits
+	// RunContext stops the execution if it is done, e.g. when its deadline is exceeded
+	RunContext context.Context
+	limits     *runLimits
+	// Errors contains the errors of events which were skipped or kept because of the on-error policy
+	Errors []*EventError
 }
 
-var ErrExited = errors.New("flows exited because of a return statement")
+// EventError is an error which occurred while running the flows for an event
+type EventError struct {
+	UID   string `json:"uid"`
+	Error string `json:"error"`
+}
 
-func runSingleDebugFlow(f *model.DebugFlow, e *ics.VEvent, sharedContext util.NamedValues) (ExecutionMessage, error) {
-	if str, ok := f.Debug.(string); ok {
-		// evaluated debug messages can start with "$"
-		if strings.HasPrefix(str, "$ ") {
-			ex, err := expr.Compile(str[2:], expr.Env(new(environ.ExprEnvironment)))
-			if err != nil {
-				return nil, err
-			}
-			env, err := environ.CreateExprEnvironmentFromEvent(e, sharedContext)
-			if err != nil {
-				return nil, err
-			}
-			res, err := expr.Run(ex, env)
-			if err != nil {
-				return nil, err
-			}
-			return &DebugExecutionMessage{Message: res}, nil
-		}
-	}
-	return &DebugExecutionMessage{f.Debug}, nil
+// MaxIterations is the maximum number of foreach iterations for a single event (or before / after flows)
+const MaxIterations = 1000
+
+var (
+	ErrExited         = errors.New("flows exited because of a return statement")
+	ErrNotIterable    = errors.New("foreach expression must return a list")
+	ErrIterationLimit = &LimitError{Limit: LimitIterations, Max: MaxIterations}
+)
+
+// syncWriter serializes the writes of events which are processed at once
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
 }
 
-func runSingleConditionFlow(f *model.ConditionFlow, e *ics.VEvent, sharedContext util.NamedValues) (ExecutionMessage, error) {
-	env, err := environ.CreateExprEnvironmentFromEvent(e, sharedContext)
-	if err != nil {
-		return nil, fmt.Errorf("create expr env err: %v", err)
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// initOutput prepares the output if Output was changed
+func (c *ContextFlow) initOutput() {
+	out := c.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	if c.output == nil || c.output.w != out {
+		c.output = &syncWriter{w: out}
 	}
+}
+
+// runner runs flows either for a single event or once for the whole calendar (before and after flows)
+type runner struct {
+	plan        *Plan
+	verbose     bool
+	enableDebug bool
+	output      io.Writer
 
-	result := false
+	// event is nil for before and after flows
+	event    *environ.Component
+	calendar *ics.Calendar
 
-	// default operator should be AND
-	isAnd := strings.ToUpper(f.Operator) != "OR"
+	sharedContext util.NamedValues
+	params        util.NamedValues
+	debugMessages *[]interface{}
+	fact          actions.ActionMessage
+	// final is true if the verdict can't be changed anymore
+	final bool
+	// iterations is the number of foreach iterations so far
+	iterations int
 
-	for _, cond := range f.Condition {
-		ex, err := expr.Compile(cond, expr.Env(new(environ.ExprEnvironment)), expr.AsBool())
+	limits *runLimits
+	// steps is the number of executed flows, depth the current nesting depth of child flows
+	steps int
+	depth int
+}
+
+// key returns the key of a compiled flow in the plan
+func (r *runner) key(flow model.Flow) planKey {
+	if r.event == nil {
+		return planKey{flow, scopeCalendar}
+	}
+	return planKey{flow, scopeEvent}
+}
+
+// env creates the expression environment for conditions and debug messages
+func (r *runner) env() (interface{}, error) {
+	if r.event == nil {
+		env := environ.CreateCalendarEnvironment(r.calendar, r.sharedContext)
+		env.Params = r.params
+		return env, nil
+	}
+	env, err := environ.CreateExprEnvironment(r.event, r.sharedContext)
+	if err != nil {
+		return nil, err
+	}
+	env.Params = r.params
+	return env, nil
+}
+
+func (r *runner) runDebugFlow(f *model.DebugFlow) (ExecutionMessage, error) {
+	// evaluated debug messages start with "$" and are compiled in the plan
+	if prog := r.plan.debugs[r.key(f)]; prog != nil {
+		env, err := r.env()
 		if err != nil {
-			return nil, fmt.Errorf("expr compile err: %v", err)
+			return nil, err
 		}
-		res, err := expr.Run(ex, env)
+		res, err := expr.Run(prog, env)
 		if err != nil {
-			return nil, fmt.Errorf("expr run err: %v", err)
+			return nil, err
 		}
-		if !res.(bool) && isAnd {
-			result = false
-			break
-		} else if res.(bool) {
-			result = true
+		return &DebugExecutionMessage{Message: res}, nil
+	}
+	return &DebugExecutionMessage{f.Debug}, nil
+}
+
+// evalCondition evaluates an expression or a group.
+// Groups stop at the first condition which decides the result, only evaluated expressions are traced.
+func (r *runner) evalCondition(c *plannedCondition, env interface{}, step *TraceStep) (bool, error) {
+	switch c.group {
+	case model.ConditionNot:
+		res, err := r.evalCondition(c.children[0], env, step)
+		return !res, err
+	case model.ConditionAll, model.ConditionAny:
+		// all is false at the first false condition, any is true at the first true condition
+		decisive := c.group == model.ConditionAny
+		for _, child := range c.children {
+			res, err := r.evalCondition(child, env, step)
+			if err != nil {
+				return false, err
+			}
+			if res == decisive {
+				return decisive, nil
+			}
 		}
+		return !decisive, nil
+	}
+	res, err := expr.Run(c.program, env)
+	if err != nil {
+		return false, fmt.Errorf("expr run err: %v", err)
+	}
+	if step != nil {
+		step.Conditions = append(step.Conditions, &ConditionTrace{
+			Expression: c.expression,
+			Result:     res.(bool),
+		})
+	}
+	return res.(bool), nil
+}
+
+func (r *runner) runConditionFlow(f *model.ConditionFlow, step *TraceStep) (ExecutionMessage, error) {
+	planned, ok := r.plan.conditions[r.key(f)]
+	if !ok {
+		return nil, ErrNotCompiled
+	}
+	env, err := r.env()
+	if err != nil {
+		return nil, fmt.Errorf("create expr env err: %v", err)
+	}
+	result, err := r.evalCondition(planned, env, step)
+	if err != nil {
+		return nil, err
+	}
+	if step != nil {
+		step.Result = &result
 	}
 	if !result {
 		return &QueueFlowsExecutionMessage{f.Else}, nil
 	}
 	return &QueueFlowsExecutionMessage{f.Then}, nil
-
 }
 
-func runSingleActionFlow(f *model.ActionFlow, e *ics.VEvent, verbose bool, sharedContext util.NamedValues) (ExecutionMessage, error) {
-	// find action
-	act := actions.Find(f.FlowIdentifier)
-	if act == nil {
-		return nil, errors.New("invalid flow identifier: " + f.FlowIdentifier)
+func (r *runner) runActionFlow(f *model.ActionFlow, step *TraceStep) (ExecutionMessage, error) {
+	act, ok := r.plan.actions[r.key(f)]
+	if !ok {
+		return nil, ErrNotCompiled
 	}
+	with := withParams(f.With, r.params)
+	if step != nil {
+		step.Action = f.FlowIdentifier
+		step.With = with
+	}
+	if r.event == nil {
+		ctx := &actions.CalendarContext{
+			Calendar:      r.calendar,
+			SharedContext: r.sharedContext,
+			With:          with,
+			Verbose:       r.verbose,
+			Output:        r.output,
+			Programs:      act.programs,
+			Params:        r.params,
+		}
+		if r.enableDebug {
+			ctx.Debug = func(message interface{}) {
+				*r.debugMessages = append(*r.debugMessages, message)
+			}
+		}
+		if err := act.calendarAction.ExecuteCalendar(ctx); err != nil {
+			return nil, fmt.Errorf("flow execute err: %v", err)
+		}
+		return nil, nil
+	}
+
 	ctx := &actions.Context{
-		Event:         e,
-		SharedContext: sharedContext,
-		With:          f.With,
-		Verbose:       verbose,
+		Component:     r.event,
+		Event:         r.event.Event(),
+		SharedContext: r.sharedContext,
+		With:          with,
+		Verbose:       r.verbose,
+		Output:        r.output,
+		Programs:      act.programs,
+		Params:        r.params,
+	}
+	var before map[string][]string
+	if step != nil {
+		before = snapshotProperties(r.event.ComponentBase)
+	}
+	msg, err := act.action.Execute(ctx)
+	if step != nil {
+		step.Changes = diffProperties(before, snapshotProperties(r.event.ComponentBase))
 	}
-	msg, err := act.Execute(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("flow execute err: %v", err)
 	}
@@ -106,52 +268,245 @@ func runSingleActionFlow(f *model.ActionFlow, e *ics.VEvent, verbose bool, share
 	return nil, nil
 }
 
-func RunSingleFlow(event *ics.VEvent, flow model.Flow, verbose, enableDebugFlow bool, sharedContext util.NamedValues) (ExecutionMessage, error) {
+// matchesCase returns true if the result of a switch matches the case.
+// Values are compared by their string representation since YAML, JSON and expressions use different number types.
+func matchesCase(res interface{}, c *model.SwitchCase, pattern *regexp.Regexp) bool {
+	str := fmt.Sprint(res)
+	if pattern != nil {
+		return pattern.MatchString(str)
+	}
+	if values, ok := c.Case.([]interface{}); ok {
+		for _, v := range values {
+			if fmt.Sprint(v) == str {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(c.Case) == str
+}
+
+func (r *runner) runSwitchFlow(f *model.SwitchFlow, step *TraceStep) (ExecutionMessage, error) {
+	planned, ok := r.plan.switches[r.key(f)]
+	if !ok {
+		return nil, ErrNotCompiled
+	}
+	env, err := r.env()
+	if err != nil {
+		return nil, fmt.Errorf("create expr env err: %v", err)
+	}
+	res, err := expr.Run(planned.program, env)
+	if err != nil {
+		return nil, fmt.Errorf("expr run err: %v", err)
+	}
+	for i, c := range f.Cases {
+		if matchesCase(res, c, planned.patterns[i]) {
+			if step != nil {
+				step.Branch = fmt.Sprintf("cases[%d]", i)
+			}
+			return &QueueFlowsExecutionMessage{c.Then}, nil
+		}
+	}
+	if step != nil {
+		step.Branch = "default"
+	}
+	return &QueueFlowsExecutionMessage{f.Default}, nil
+}
+
+// runTryFlow runs the try flows and queues the catch flows if an error occurred.
+// Return statements and the iteration limit are not caught.
+func (r *runner) runTryFlow(f *model.TryFlow, step *TraceStep) (ExecutionMessage, error) {
+	var children *[]*TraceStep
+	if step != nil {
+		children = &step.Steps
+	}
+	err := r.runFlows(f.Try, children)
+	if err == nil {
+		return nil, nil
+	}
+	if err == ErrExited {
+		return new(ExitFlowsExecutionMessage), nil
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		return nil, err
+	}
+	r.sharedContext["error"] = err.Error()
+	return &QueueFlowsExecutionMessage{f.Catch}, nil
+}
+
+func (r *runner) runUseFlow(f *model.UseFlow, step *TraceStep) (ExecutionMessage, error) {
+	flows, ok := r.plan.definitions[f.Use]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDefinition, f.Use)
+	}
+	with := withParams(f.With, r.params)
+	if step != nil {
+		step.With = with
+	}
+	// parameters are passed to the definition using the shared context
+	for k, v := range with {
+		r.sharedContext[k] = v
+	}
+	return &QueueFlowsExecutionMessage{flows}, nil
+}
+
+func (r *runner) runForeachFlow(f *model.ForeachFlow) (ExecutionMessage, error) {
+	prog, ok := r.plan.loops[r.key(f)]
+	if !ok {
+		return nil, ErrNotCompiled
+	}
+	env, err := r.env()
+	if err != nil {
+		return nil, fmt.Errorf("create expr env err: %v", err)
+	}
+	res, err := expr.Run(prog, env)
+	if err != nil {
+		return nil, fmt.Errorf("expr run err: %v", err)
+	}
+	if res == nil {
+		return nil, nil
+	}
+	list := reflect.ValueOf(res)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w, got %T", ErrNotIterable, res)
+	}
+	items := make([]interface{}, list.Len())
+	for i := range items {
+		items[i] = list.Index(i).Interface()
+	}
+	return &IterateFlowsExecutionMessage{Name: f.Name(), Items: items, Flows: f.Flows}, nil
+}
+
+// runIteration runs the flows for every item and restores the previous value of the name afterwards
+func (r *runner) runIteration(msg *IterateFlowsExecutionMessage, step *TraceStep) error {
+	prev, hadPrev := r.sharedContext[msg.Name]
+	defer func() {
+		if hadPrev {
+			r.sharedContext[msg.Name] = prev
+		} else {
+			delete(r.sharedContext, msg.Name)
+		}
+	}()
+	var children *[]*TraceStep
+	if step != nil {
+		children = &step.Steps
+	}
+	for _, item := range msg.Items {
+		// limit iterations over all loops so nested loops can't run forever
+		if r.iterations++; r.iterations > MaxIterations {
+			if step != nil {
+				step.Error = ErrIterationLimit.Error()
+			}
+			return ErrIterationLimit
+		}
+		if step != nil {
+			step.Iterations++
+		}
+		r.sharedContext[msg.Name] = item
+		if err := r.runFlows(msg.Flows, children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordVerdict sets the verdict of the event unless a final verdict was set before
+func (r *runner) recordVerdict(fact actions.ActionMessage, step *TraceStep) {
+	if step != nil {
+		step.Verdict = verdictOf(fact)
+		step.Ignored = r.final
+	}
+	if r.final {
+		return
+	}
+	r.fact = fact
+	r.final = isFinal(fact)
+}
+
+// runFlow runs a flow and returns what should happen next.
+// If step is not nil, the execution is recorded to the step.
+func (r *runner) runFlow(flow model.Flow, step *TraceStep) (ExecutionMessage, error) {
 	switch f := flow.(type) {
 
 	// ReturnFlow:
 	// Exit loop
 	case *model.ReturnFlow:
-		if !f.Return {
+		if !f.Return.Exit {
 			return nil, nil
 		}
+		if f.Return.Verdict != "" {
+			fact := actions.ActionMessage(new(actions.FilterInActionMessage))
+			if f.Return.Verdict == model.ReturnDrop {
+				fact = new(actions.FilterOutActionMessage)
+			}
+			r.recordVerdict(fact, step)
+		}
 		return new(ExitFlowsExecutionMessage), nil
 
 	// DebugFlow:
 	// Print message to console
 	case *model.DebugFlow:
-		if !enableDebugFlow {
+		if !r.enableDebug {
 			return nil, nil
 		}
-		return runSingleDebugFlow(f, event, sharedContext)
+		return r.runDebugFlow(f)
 
 	// ConditionFlow:
 	// Check condition and execute child flows
 	case *model.ConditionFlow:
-		return runSingleConditionFlow(f, event, sharedContext)
+		return r.runConditionFlow(f, step)
 
 	// ActionFlow
 	// Run a specific action
 	case *model.ActionFlow:
-		return runSingleActionFlow(f, event, verbose, sharedContext)
+		return r.runActionFlow(f, step)
+
+	// UseFlow
+	// Run the flows of a definition
+	case *model.UseFlow:
+		return r.runUseFlow(f, step)
+
+	// ForeachFlow
+	// Run child flows for every item
+	case *model.ForeachFlow:
+		return r.runForeachFlow(f)
+
+	// SwitchFlow
+	// Run the first matching case
+	case *model.SwitchFlow:
+		return r.runSwitchFlow(f, step)
+
+	// TryFlow
+	// Run child flows and catch errors
+	case *model.TryFlow:
+		return r.runTryFlow(f, step)
 	}
 
 	return nil, nil
 }
 
-func RunMultiFlowsRecursive(
-	fact *actions.ActionMessage,
-	event *ics.VEvent,
-	flows model.Flows,
-	debugMessages *[]interface{},
-	verbose, enableDebugFlow bool,
-	sharedContext util.NamedValues,
-) error {
+// runFlows runs flows in order and records them to trace (if not nil)
+func (r *runner) runFlows(flows model.Flows, trace *[]*TraceStep) error {
+	r.depth++
+	defer func() {
+		r.depth--
+	}()
 	for _, flow := range flows {
-		msg, err := RunSingleFlow(event, flow, verbose, enableDebugFlow, sharedContext)
+		if err := r.checkLimits(); err != nil {
+			return err
+		}
+		var step *TraceStep
+		if trace != nil {
+			step = &TraceStep{Flow: flow.KeyIdentifier()}
+			*trace = append(*trace, step)
+		}
+		msg, err := r.runFlow(flow, step)
 		// oh no, we always exit on errors
 		if err != nil {
-			return fmt.Errorf("single flow error: %v", err)
+			if step != nil {
+				step.Error = err.Error()
+			}
+			return fmt.Errorf("single flow error: %w", err)
 		}
 		// if msg is null, all good and continue loop
 		if msg == nil {
@@ -160,28 +515,167 @@ func RunMultiFlowsRecursive(
 		switch t := msg.(type) {
 		case *ExitFlowsExecutionMessage:
 			// exit flow execution loop
+			if step != nil {
+				step.Exit = true
+			}
 			return ErrExited
 		case *QueueFlowsExecutionMessage:
-			if err = RunMultiFlowsRecursive(fact, event, t.Flows, debugMessages, verbose, enableDebugFlow, sharedContext); err != nil {
+			var children *[]*TraceStep
+			if step != nil {
+				children = &step.Steps
+			}
+			if err = r.runFlows(t.Flows, children); err != nil {
 				// if a child flow exited (or failed) also exit all parents
 				return err
 			}
+		case *IterateFlowsExecutionMessage:
+			if err = r.runIteration(t, step); err != nil {
+				return err
+			}
 		case *FilterResultExecutionMessage:
-			*fact = t.Action
+			r.recordVerdict(t.Action, step)
 		case *DebugExecutionMessage:
-			if enableDebugFlow {
-				fmt.Println("[DEBUG]", t.Message)
-				*debugMessages = append(*debugMessages, t.Message)
+			if step != nil {
+				step.Message = t.Message
+			}
+			if r.enableDebug {
+				_, _ = fmt.Fprintln(r.output, "[DEBUG]", t.Message)
+				*r.debugMessages = append(*r.debugMessages, t.Message)
 			}
 		}
 	}
 	return nil
 }
 
-func (c *ContextFlow) RunMultiFlows(event *ics.VEvent, flows model.Flows) (actions.ActionMessage, error) {
-	// filter everything in by default
-	var fact actions.ActionMessage = new(actions.FilterInActionMessage)
-	sharedContext := make(util.NamedValues)
-	err := RunMultiFlowsRecursive(&fact, event, flows, &c.Debugs, c.Verbose, c.EnableDebug, sharedContext)
+// RunPlan runs all flows of the plan for an event
+func (c *ContextFlow) RunPlan(event *environ.Component, plan *Plan) (actions.ActionMessage, error) {
+	c.initLimits()
+	c.initOutput()
+	fact, trace, err := c.runEvent(event, plan, &c.Debugs)
+	if trace != nil {
+		c.Traces = append(c.Traces, trace)
+	}
 	return fact, err
 }
+
+// runEvent runs all flows of the plan for an event and appends debug messages to debugMessages.
+// The returned trace is nil if tracing is disabled.
+func (c *ContextFlow) runEvent(event *environ.Component, plan *Plan, debugMessages *[]interface{}) (actions.ActionMessage, *EventTrace, error) {
+	// every event starts with a copy of the calendar context
+	sharedContext := make(util.NamedValues, len(c.Context))
+	for k, v := range c.Context {
+		sharedContext[k] = v
+	}
+	r := &runner{
+		plan:          plan,
+		verbose:       c.Verbose,
+		enableDebug:   c.EnableDebug,
+		output:        c.output,
+		event:         event,
+		sharedContext: sharedContext,
+		params:        c.Params,
+		limits:        c.limits,
+		debugMessages: debugMessages,
+		// filter everything in by default
+		fact: new(actions.FilterInActionMessage),
+	}
+
+	var (
+		trace *EventTrace
+		steps *[]*TraceStep
+	)
+	if c.EnableTrace {
+		trace = &EventTrace{UID: event.Id()}
+		steps = &trace.Steps
+	}
+
+	// keep a copy of the event to restore it if an error occurs
+	var original *ics.ComponentBase
+	if c.onError() == model.OnErrorKeepEvent {
+		clone := util.CloneComponentBase(event.ComponentBase)
+		original = &clone
+	}
+
+	err := r.runFlows(plan.Flows, steps)
+	if err != nil && err != ErrExited && original != nil {
+		*event.ComponentBase = *original
+	}
+	if trace != nil {
+		trace.Verdict = verdictOf(r.fact)
+		if err != nil && err != ErrExited {
+			trace.Error = err.Error()
+		}
+	}
+	return r.fact, trace, err
+}
+
+// onError returns the on-error policy of the profile
+func (c *ContextFlow) onError() string {
+	if c.Profile == nil || c.Profile.OnError == "" {
+		return model.OnErrorFail
+	}
+	return c.Profile.OnError
+}
+
+// handleEventError applies the on-error policy if an error occurred for an event.
+// Returns the error if the policy is "fail", otherwise the error is recorded in Errors.
+func (c *ContextFlow) handleEventError(event *environ.Component, fact actions.ActionMessage, err error) (actions.ActionMessage, error) {
+	if err == nil || err == ErrExited {
+		return fact, nil
+	}
+	// exceeded limits always stop the run
+	if errors.Is(err, ErrLimitExceeded) {
+		return nil, err
+	}
+	switch c.onError() {
+	case model.OnErrorSkipEvent:
+		fact = new(actions.FilterOutActionMessage)
+	case model.OnErrorKeepEvent:
+		fact = new(actions.FilterInActionMessage)
+	default:
+		return nil, err
+	}
+	c.Errors = append(c.Errors, &EventError{UID: event.Id(), Error: err.Error()})
+	return fact, nil
+}
+
+// RunCalendarFlows runs before or after flows once for the whole calendar
+func (c *ContextFlow) RunCalendarFlows(cal *ics.Calendar, plan *Plan, scope string, flows model.Flows) error {
+	if c.Context == nil {
+		c.Context = make(map[string]interface{})
+	}
+	c.initLimits()
+	c.initOutput()
+	r := &runner{
+		plan:          plan,
+		verbose:       c.Verbose,
+		enableDebug:   c.EnableDebug,
+		output:        c.output,
+		calendar:      cal,
+		sharedContext: c.Context,
+		params:        c.Params,
+		limits:        c.limits,
+		debugMessages: &c.Debugs,
+	}
+
+	var (
+		trace *EventTrace
+		steps *[]*TraceStep
+	)
+	if c.EnableTrace {
+		trace = &EventTrace{Scope: scope}
+		steps = &trace.Steps
+	}
+
+	err := r.runFlows(flows, steps)
+	if err == ErrExited {
+		err = nil
+	}
+	if trace != nil {
+		if err != nil {
+			trace.Error = err.Error()
+		}
+		c.Traces = append(c.Traces, trace)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUseDefinition(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+definitions:
+  rename:
+    - do: actions/regex-replace
+      with:
+        match: '^'
+        replace: '[Lecture] '
+        in: [ "summary" ]
+    - if: 'Context.drop == true'
+      then:
+        - do: filters/filter-out
+flows:
+  - if: 'Event.Summary() == "a"'
+    then:
+      - use: rename
+        with:
+          drop: false
+    else:
+      - use: rename
+        with:
+          drop: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "a", start))
+	cal.AddVEvent(newTestEvent("b", "b", start))
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 1 || events[0].GetProperty(ics.ComponentPropertySummary).Value != "[Lecture] a" {
+		t.Fatalf("unexpected events after modify: %d", len(events))
+	}
+}
+
+func TestUnknownDefinition(t *testing.T) {
+	profile, err := model.ParseProfileFromJSON([]byte(`{"flows": [{"use": "nope"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CompileProfile(profile); !errors.Is(err, ErrUnknownDefinition) {
+		t.Fatalf("expected ErrUnknownDefinition, got %v", err)
+	}
+}
+
+func TestRecursiveDefinition(t *testing.T) {
+	_, err := model.ParseProfileFromYAML(strings.NewReader(`
+definitions:
+  a:
+    - if: 'true'
+      then:
+        - use: b
+  b:
+    - use: a
+`))
+	if !errors.Is(err, model.ErrRecursiveDefinition) || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Fatalf("expected recursion error for yaml, got %v", err)
+	}
+
+	_, err = model.ParseProfileFromJSON([]byte(`{"definitions": {"a": [{"use": "a"}]}}`))
+	if !errors.Is(err, model.ErrRecursiveDefinition) {
+		t.Fatalf("expected recursion error for json, got %v", err)
+	}
+
+	data, err := bson.Marshal(bson.M{"definitions": bson.M{
+		"a": bson.A{bson.M{"use": "b"}},
+		"b": bson.A{bson.M{"use": "a"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile model.Profile
+	if err = bson.Unmarshal(data, &profile); !errors.Is(err, model.ErrRecursiveDefinition) {
+		t.Fatalf("expected recursion error for bson, got %v", err)
+	}
+}
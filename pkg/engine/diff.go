@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"strings"
+)
+
+// CalendarDiff describes the changes of processing a calendar
+type CalendarDiff struct {
+	Removed   []*EventSummary `json:"removed,omitempty"`
+	Added     []*EventSummary `json:"added,omitempty"`
+	Changed   []*EventDiff    `json:"changed,omitempty"`
+	Unchanged int             `json:"unchanged"`
+}
+
+// EventSummary identifies an event in a diff
+type EventSummary struct {
+	UID          string `json:"uid"`
+	RecurrenceID string `json:"recurrence-id,omitempty"`
+	Summary      string `json:"summary,omitempty"`
+	Start        string `json:"start,omitempty"`
+}
+
+// EventDiff contains the changed properties of an event
+type EventDiff struct {
+	EventSummary
+	Changes []*PropertyChange `json:"changes"`
+}
+
+type snapshotEvent struct {
+	key        string
+	summary    *EventSummary
+	properties map[string][]string
+}
+
+// CalendarSnapshot contains the events of a calendar before it was processed
+type CalendarSnapshot struct {
+	events []*snapshotEvent
+}
+
+// snapshotEvents returns the events (tasks, journal entries) of the calendar by UID and RECURRENCE-ID
+func snapshotEvents(cal *ics.Calendar) []*snapshotEvent {
+	var res []*snapshotEvent
+	for _, c := range cal.Components {
+		component := environ.NewComponent(c)
+		if component == nil {
+			continue
+		}
+		summary := &EventSummary{UID: component.Id()}
+		if p := component.GetProperty(ics.ComponentProperty(ics.PropertyRecurrenceId)); p != nil {
+			summary.RecurrenceID = p.Value
+		}
+		if p := component.GetProperty(ics.ComponentPropertySummary); p != nil {
+			summary.Summary = ics.FromText(p.Value)
+		}
+		if p := component.GetProperty(ics.ComponentPropertyDtStart); p != nil {
+			summary.Start = p.Value
+		}
+		res = append(res, &snapshotEvent{
+			key:        summary.UID + "/" + summary.RecurrenceID,
+			summary:    summary,
+			properties: snapshotProperties(component.ComponentBase),
+		})
+	}
+	return res
+}
+
+// Snapshot captures the events of a calendar before it is modified (e.g. by ModifyCalendar)
+func Snapshot(cal *ics.Calendar) *CalendarSnapshot {
+	return &CalendarSnapshot{events: snapshotEvents(cal)}
+}
+
+// Diff compares the snapshot with the processed calendar
+func (s *CalendarSnapshot) Diff(cal *ics.Calendar) *CalendarDiff {
+	diff := new(CalendarDiff)
+	after := snapshotEvents(cal)
+	byKey := make(map[string]*snapshotEvent, len(after))
+	for _, e := range after {
+		if _, ok := byKey[e.key]; !ok {
+			byKey[e.key] = e
+		}
+	}
+	seen := make(map[string]bool, len(s.events))
+	for _, before := range s.events {
+		seen[before.key] = true
+		a, ok := byKey[before.key]
+		if !ok {
+			diff.Removed = append(diff.Removed, before.summary)
+			continue
+		}
+		if changes := diffProperties(before.properties, a.properties); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, &EventDiff{EventSummary: *a.summary, Changes: changes})
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for _, e := range after {
+		if !seen[e.key] {
+			seen[e.key] = true
+			diff.Added = append(diff.Added, e.summary)
+		}
+	}
+	return diff
+}
+
+func (e *EventSummary) String() string {
+	var b strings.Builder
+	b.WriteString(e.UID)
+	if e.RecurrenceID != "" {
+		b.WriteString(" (" + e.RecurrenceID + ")")
+	}
+	if e.Summary != "" {
+		b.WriteString(": " + e.Summary)
+	}
+	if e.Start != "" {
+		b.WriteString(" @ " + e.Start)
+	}
+	return b.String()
+}
+
+// String returns the human-readable diff
+func (d *CalendarDiff) String() string {
+	var b strings.Builder
+	for _, e := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", e)
+	}
+	for _, e := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", e)
+	}
+	for _, e := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", &e.EventSummary)
+		for _, change := range e.Changes {
+			// single values are shown as a replacement, multiple values (e.g. ATTENDEE) as removed and added values
+			if len(change.Before) <= 1 && len(change.After) <= 1 {
+				fmt.Fprintf(&b, "    %s: '%s' -> '%s'\n", change.Property, first(change.Before), first(change.After))
+				continue
+			}
+			for _, v := range subtract(change.Before, change.After) {
+				fmt.Fprintf(&b, "    %s: - '%s'\n", change.Property, v)
+			}
+			for _, v := range subtract(change.After, change.Before) {
+				fmt.Fprintf(&b, "    %s: + '%s'\n", change.Property, v)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d removed, %d added, %d changed, %d unchanged\n",
+		len(d.Removed), len(d.Added), len(d.Changed), d.Unchanged)
+	return b.String()
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// subtract returns the values of a which are not in b
+func subtract(a, b []string) (res []string) {
+	counts := make(map[string]int, len(b))
+	for _, v := range b {
+		counts[v]++
+	}
+	for _, v := range a {
+		if counts[v] > 0 {
+			counts[v]--
+			continue
+		}
+		res = append(res, v)
+	}
+	return
+}
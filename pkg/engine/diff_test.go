@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - if: 'Event.Summary() contains "B2"'
+    then:
+      - do: filters/filter-out
+  - do: actions/regex-replace
+    with:
+      match: 'TINF\d+\w+ '
+      replace: ''
+      in: [ summary ]
+  - if: 'Event.Summary() == "Math"'
+    then:
+      - do: actions/add-attendee
+        with:
+          mail: bob@example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err := testInput(&model.Test{Input: suiteEvents + `
+BEGIN:VEVENT
+UID:lunch
+SUMMARY:Lunch
+DTSTART:20230102T130000Z
+DTEND:20230102T140000Z
+END:VEVENT
+`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := Snapshot(cal)
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	diff := snapshot.Diff(cal)
+	if len(diff.Removed) != 1 || diff.Removed[0].UID != "physics" {
+		t.Fatalf("expected physics to be removed, got %+v", diff.Removed)
+	}
+	if len(diff.Added) != 0 || diff.Unchanged != 1 {
+		t.Fatalf("expected no added and 1 unchanged event, got %+v", diff)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].UID != "math" || len(diff.Changed[0].Changes) != 2 {
+		t.Fatalf("expected math to be changed, got %+v", diff.Changed)
+	}
+	expected := `- physics: TINF22B2 Physics @ 20230102T120000Z
+~ math: Math @ 20230102T100000Z
+    ATTENDEE: '' -> 'mailto:bob@example.com'
+    SUMMARY: 'TINF22B1 Math' -> 'Math'
+1 removed, 0 added, 1 changed, 1 unchanged
+`
+	if got := diff.String(); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
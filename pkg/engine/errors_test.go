@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const errorPolicyFlows = `
+flows:
+  - do: actions/regex-replace
+    with:
+      match: '^'
+      replace: '* '
+      in: [ "summary" ]
+  # fails for events with a summary which is not a number
+  - if: 'int(Trim(Replace(Event.Summary(), "*", ""))) > 0'
+`
+
+func runErrorPolicy(t *testing.T, policy string, workers int) (*ContextFlow, *ics.Calendar, error) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(errorPolicyFlows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.OnError = policy
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cal.AddVEvent(newTestEvent("a", "1", start))
+	cal.AddVEvent(newTestEvent("b", "broken", start))
+	ctx := &ContextFlow{Profile: profile, Workers: workers}
+	return ctx, cal, ModifyCalendar(ctx, plan, cal)
+}
+
+func TestOnError(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		if _, _, err := runErrorPolicy(t, model.OnErrorFail, workers); err == nil {
+			t.Fatal("expected error")
+		}
+
+		ctx, cal, err := runErrorPolicy(t, model.OnErrorSkipEvent, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cal.Events()) != 1 || len(ctx.Errors) != 1 || ctx.Errors[0].UID != "b" {
+			t.Fatalf("expected b to be skipped, got %d events, %d errors", len(cal.Events()), len(ctx.Errors))
+		}
+
+		ctx, cal, err = runErrorPolicy(t, model.OnErrorKeepEvent, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := cal.Events()
+		if len(events) != 2 || len(ctx.Errors) != 1 {
+			t.Fatalf("expected both events to be kept, got %d events, %d errors", len(events), len(ctx.Errors))
+		}
+		// the broken event is kept unchanged
+		if events[1].GetProperty(ics.ComponentPropertySummary).Value != "broken" {
+			t.Fatal("expected broken event to be restored")
+		}
+	}
+
+	if _, _, err := runErrorPolicy(t, "ignore", 0); !errors.Is(err, ErrUnknownErrorPolicy) {
+		t.Fatalf("expected ErrUnknownErrorPolicy, got %v", err)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - try:
+      - if: 'int(Event.Summary()) > 1'
+        then:
+          - do: filters/filter-out
+    catch:
+      - do: ctx/set
+        with:
+          $message: 'Context.error'
+      - do: actions/regex-replace
+        with:
+          match: '^'
+          replace: '[not a number] '
+          in: [ "summary" ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "Lecture", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 1 || events[0].GetProperty(ics.ComponentPropertySummary).Value != "[not a number] Lecture" {
+		t.Fatal("expected catch flows to run")
+	}
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runForeach(t *testing.T, flows string, event *ics.VEvent) (*ics.Calendar, error) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nflows:\n" + flows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	cal.AddVEvent(event)
+	return cal, ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal)
+}
+
+func TestForeach(t *testing.T) {
+	event := newTestEvent("a", "Lecture", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC))
+	event.AddAttendee("prof@uni.example")
+	event.AddAttendee("spam@list.example")
+	event.AddAttendee("other@list.example")
+	event.SetProperty(ics.ComponentPropertyCategories, "Exam,Lab")
+
+	cal, err := runForeach(t, `
+  - foreach: 'Event.Attendees()'
+    as: attendee
+    flows:
+      - if: 'Context.attendee matches "@list\\.example$"'
+        then:
+          - do: actions/remove-attendee
+            with:
+              $mail: 'Context.attendee'
+  - foreach: 'Split(Event.Categories(), ",")'
+    flows:
+      - do: actions/add-alarm
+        with:
+          action: display
+          trigger: '-PT15M'
+  - if: 'Context.attendee == nil and Context.item == nil'
+    else:
+      - do: filters/filter-out
+`, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 1 {
+		t.Fatal("expected loop variables to be removed after the loop")
+	}
+	if attendees := events[0].Attendees(); len(attendees) != 1 || attendees[0].Email() != "prof@uni.example" {
+		t.Fatalf("expected only prof@uni.example, got %d attendees", len(attendees))
+	}
+	if alarms := events[0].Alarms(); len(alarms) != 2 {
+		t.Fatalf("expected 2 alarms, got %d", len(alarms))
+	}
+}
+
+func TestForeachLimit(t *testing.T) {
+	event := newTestEvent("a", "Lecture", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC))
+	_, err := runForeach(t, `
+  - foreach: 'Split(Repeat("a,", 40), ",")'
+    flows:
+      - foreach: 'Split(Repeat("b,", 40), ",")'
+        flows: []
+`, event)
+	if !errors.Is(err, ErrIterationLimit) {
+		t.Fatalf("expected ErrIterationLimit, got %v", err)
+	}
+
+	_, err = runForeach(t, `
+  - foreach: 'Event.Summary()'
+    flows: []
+`, event)
+	if !errors.Is(err, ErrNotIterable) {
+		t.Fatalf("expected ErrNotIterable, got %v", err)
+	}
+}
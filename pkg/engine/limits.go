@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	LimitDepth         = "depth"
+	LimitStepsPerEvent = "steps-per-event"
+	LimitSteps         = "steps"
+	LimitIterations    = "iterations"
+	LimitDeadline      = "deadline"
+)
+
+// ErrLimitExceeded matches every LimitError using errors.Is
+var ErrLimitExceeded = errors.New("execution limit exceeded")
+
+// LimitError is returned if a limit was exceeded while running flows
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. "depth"
+	Limit string
+	// Max is the configured maximum (0 for the deadline)
+	Max int
+	// Err is the cause (only set for the deadline)
+	Err error
+}
+
+func (l *LimitError) Error() string {
+	if l.Err != nil {
+		return fmt.Sprintf("%v: %s (%v)", ErrLimitExceeded, l.Limit, l.Err)
+	}
+	return fmt.Sprintf("%v: %s (max %d)", ErrLimitExceeded, l.Limit, l.Max)
+}
+
+func (l *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func (l *LimitError) Unwrap() error {
+	return l.Err
+}
+
+// Limits restrict the execution of flows for hosted profiles.
+// Zero values disable a limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of child flows (if, switch, foreach, use, try)
+	MaxDepth int
+	// MaxStepsPerEvent is the maximum number of flows executed for a single event
+	MaxStepsPerEvent int
+	// MaxSteps is the maximum number of flows executed for the whole calendar
+	MaxSteps int
+}
+
+// checkLimits is called by the runner before a flow is executed
+func (r *runner) checkLimits() error {
+	if r.limits == nil {
+		return nil
+	}
+	if err := r.limits.ctx.Err(); err != nil {
+		return &LimitError{Limit: LimitDeadline, Err: err}
+	}
+	if max := r.limits.MaxDepth; max > 0 && r.depth > max {
+		return &LimitError{Limit: LimitDepth, Max: max}
+	}
+	r.steps++
+	if max := r.limits.MaxStepsPerEvent; max > 0 && r.steps > max {
+		return &LimitError{Limit: LimitStepsPerEvent, Max: max}
+	}
+	if max := r.limits.MaxSteps; max > 0 && r.limits.steps.Add(1) > int64(max) {
+		return &LimitError{Limit: LimitSteps, Max: max}
+	}
+	return nil
+}
+
+// runLimits are the limits of a single run which are shared by all events
+type runLimits struct {
+	Limits
+	ctx   context.Context
+	steps atomic.Int64
+}
+
+// initLimits prepares the limits for a run if they are not prepared yet
+func (c *ContextFlow) initLimits() {
+	if c.limits == nil {
+		c.resetLimits()
+	}
+}
+
+// resetLimits starts a new run, e.g. with a new RunContext and without the steps of the previous run
+func (c *ContextFlow) resetLimits() {
+	ctx := c.RunContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.limits = &runLimits{Limits: c.Limits, ctx: ctx}
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const limitsFlows = `
+on-error: skip-event
+flows:
+  - try:
+      - if: 'true'
+        then:
+          - if: 'true'
+            then:
+              - debug: nested
+    catch: []
+  - debug: a
+  - debug: b
+`
+
+func runWithLimits(t *testing.T, limits Limits, runCtx context.Context, workers int) error {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(limitsFlows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		cal.AddVEvent(newTestEvent(fmt.Sprint(i), "Lecture", start))
+	}
+	ctx := &ContextFlow{Profile: profile, Limits: limits, RunContext: runCtx, Workers: workers}
+	return ModifyCalendar(ctx, plan, cal)
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{0, 4} {
+		if err := runWithLimits(t, Limits{MaxDepth: 4, MaxStepsPerEvent: 6, MaxSteps: 60}, nil, workers); err != nil {
+			t.Fatalf("expected no error within limits, got %v", err)
+		}
+		for limit, tc := range map[string]struct {
+			limits Limits
+			ctx    context.Context
+		}{
+			LimitDepth:         {limits: Limits{MaxDepth: 3}},
+			LimitStepsPerEvent: {limits: Limits{MaxStepsPerEvent: 5}},
+			LimitSteps:         {limits: Limits{MaxSteps: 59}},
+			LimitDeadline:      {ctx: cancelled},
+		} {
+			err := runWithLimits(t, tc.limits, tc.ctx, workers)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != limit || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("expected %s limit error, got %v", limit, err)
+			}
+		}
+	}
+}
+
+func TestLimitsReset(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(limitsFlows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCalendar := func() *ics.Calendar {
+		cal := ics.NewCalendar()
+		for i := 0; i < 10; i++ {
+			cal.AddVEvent(newTestEvent(fmt.Sprint(i), "Lecture", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+		}
+		return cal
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := &ContextFlow{Profile: profile, Limits: Limits{MaxSteps: 60}, RunContext: cancelled}
+	if err = ModifyCalendar(ctx, plan, newCalendar()); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	// the same context can run another calendar with a new run context and new step counts
+	ctx.RunContext = context.Background()
+	for i := 0; i < 2; i++ {
+		if err = ModifyCalendar(ctx, plan, newCalendar()); err != nil {
+			t.Fatalf("run %d: expected limits to be reset, got %v", i+1, err)
+		}
+	}
+}
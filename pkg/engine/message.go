@@ -18,6 +18,14 @@ type QueueFlowsExecutionMessage struct {
 	Flows model.Flows
 }
 
+// IterateFlowsExecutionMessage executes flows once for every item.
+// The current item is set in the shared context as Name.
+type IterateFlowsExecutionMessage struct {
+	Name  string
+	Items []interface{}
+	Flows model.Flows
+}
+
 type FilterResultExecutionMessage struct {
 	Action actions.ActionMessage
 }
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	ErrUnknownParam      = errors.New("unknown parameter")
+	ErrParamInExpression = errors.New("expressions can't contain ${Params.<name>}, use Params.<name> instead")
+)
+
+// paramPattern matches references to profile parameters in `with` values, e.g. `${Params.group}`
+var paramPattern = regexp.MustCompile(`\$\{Params\.([^}]+)}`)
+
+// referencedParams returns the names of all parameters referenced in a value (including lists and maps)
+func referencedParams(value interface{}) (res []string) {
+	switch v := value.(type) {
+	case string:
+		for _, match := range paramPattern.FindAllStringSubmatch(v, -1) {
+			res = append(res, match[1])
+		}
+	case []interface{}:
+		for _, item := range v {
+			res = append(res, referencedParams(item)...)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			res = append(res, referencedParams(item)...)
+		}
+	}
+	return
+}
+
+// withParams returns a copy of with where all parameter references are replaced by their values.
+// Values which only consist of a single reference keep the type of the parameter.
+func withParams(with map[string]interface{}, params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 || with == nil {
+		return with
+	}
+	return replaceParams(with, params).(map[string]interface{})
+}
+
+func replaceParams(value interface{}, params map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if match := paramPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			return params[match[1]]
+		}
+		return paramPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			return fmt.Sprint(params[paramPattern.FindStringSubmatch(ref)[1]])
+		})
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = replaceParams(item, params)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = replaceParams(item, params)
+		}
+		return res
+	}
+	return value
+}
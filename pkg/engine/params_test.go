@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const paramsProfile = `
+params:
+  group:
+    allowed: [ B1, B2 ]
+  limit:
+    type: int
+    default: 1
+flows:
+  - if: 'not (Event.Summary() matches "^" + Params.group + " ")'
+    then:
+      - do: filters/filter-out
+  - do: actions/regex-replace
+    with:
+      match: '^${Params.group} '
+      replace: '[${Params.group}] '
+      in: [ "summary" ]
+after:
+  - do: calendar/limit
+    with:
+      max: '${Params.limit}'
+`
+
+func TestParams(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(paramsProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := map[string]string{"group": "B1"}
+	params, err := profile.Params.Resolve(func(name string) (string, bool) {
+		v, ok := query[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cal.AddVEvent(newTestEvent("a", "B1 Math", start))
+	cal.AddVEvent(newTestEvent("b", "B2 Math", start))
+	cal.AddVEvent(newTestEvent("c", "B1 Physics", start))
+	if err = ModifyCalendar(&ContextFlow{Profile: profile, Params: params}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 1 || events[0].GetProperty(ics.ComponentPropertySummary).Value != "[B1] Math" {
+		t.Fatalf("unexpected events after modify: %d", len(events))
+	}
+}
+
+func TestParamsInvalid(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(paramsProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []map[string]string{
+		{},
+		{"group": "C1"},
+		{"group": "B1", "limit": "many"},
+	} {
+		_, err = profile.Params.Resolve(func(name string) (string, bool) {
+			v, ok := query[name]
+			return v, ok
+		})
+		if !errors.Is(err, model.ErrMissingParam) && !errors.Is(err, model.ErrInvalidParam) {
+			t.Fatalf("expected parameter error for %v, got %v", query, err)
+		}
+	}
+
+	delete(profile.Params, "limit")
+	if _, err = CompileProfile(profile); !errors.Is(err, ErrUnknownParam) {
+		t.Fatalf("expected ErrUnknownParam, got %v", err)
+	}
+}
+
+const expressionParamsProfile = `
+params:
+  group: {}
+  mail: {}
+before:
+  - do: ctx/set
+    with:
+      $calendarGroup: 'Params.group'
+  - do: calendar/set-property
+    with:
+      property: X-GROUP
+      $value: 'Params.group + "!"'
+flows:
+  - do: ctx/set
+    with:
+      $eventGroup: 'Params.group'
+  - do: actions/set-property
+    with:
+      property: X-G
+      $value: 'Params.group + "/" + Context.calendarGroup + "/" + Context.eventGroup'
+  - do: actions/set-property
+    with:
+      property: X-T
+      template: '[${Params.group}]'
+  - do: actions/remove-attendee
+    with:
+      $mail: 'Params.mail'
+after:
+  - do: calendar/dedupe
+    with:
+      $key: 'Event.Summary() + Params.group'
+`
+
+func TestParamsInExpressions(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(expressionParamsProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	first := newTestEvent("a", "Math", start)
+	first.AddAttendee("a@example.com")
+	first.AddAttendee("b@example.com")
+	cal.AddVEvent(first)
+	cal.AddVEvent(newTestEvent("b", "Math", start))
+	params := map[string]interface{}{"group": "B1", "mail": "a@example.com"}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile, Params: params}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	if v := util.GetCalendarProperty(cal, "X-GROUP"); v != "B1!" {
+		t.Fatalf("calendar/set-property: expected 'B1!', got '%s'", v)
+	}
+	events := cal.Events()
+	if len(events) != 1 {
+		t.Fatalf("calendar/dedupe: expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+	if v := event.GetProperty("X-G").Value; v != "B1/B1/B1" {
+		t.Fatalf("ctx/set and actions/set-property $value: expected 'B1/B1/B1', got '%s'", v)
+	}
+	if v := event.GetProperty("X-T").Value; v != "[B1]" {
+		t.Fatalf("actions/set-property template: expected '[B1]', got '%s'", v)
+	}
+	if attendees := event.Attendees(); len(attendees) != 1 || attendees[0].Email() != "b@example.com" {
+		t.Fatalf("actions/remove-attendee: expected only b@example.com, got %d attendees", len(attendees))
+	}
+}
+
+func TestParamReferenceInExpression(t *testing.T) {
+	for _, flows := range []string{
+		"before:\n  - do: ctx/set\n    with:\n      $x: \"'${Params.group}'\"",
+		"before:\n  - do: calendar/set-property\n    with:\n      property: X-A\n      $value: \"'${Params.group}'\"",
+		"flows:\n  - do: ctx/set\n    with:\n      $x: \"'${Params.group}'\"",
+		"flows:\n  - do: actions/set-property\n    with:\n      property: X-A\n      $value: \"'${Params.group}'\"",
+		"flows:\n  - do: actions/remove-attendee\n    with:\n      $mail: \"'${Params.group}'\"",
+		"after:\n  - do: calendar/dedupe\n    with:\n      $key: \"'${Params.group}'\"",
+	} {
+		profile, err := model.ParseProfileFromYAML(strings.NewReader("params:\n  group: {}\n" + flows + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = CompileProfile(profile); !errors.Is(err, ErrParamInExpression) {
+			t.Fatalf("expected ErrParamInExpression for %q, got %v", flows, err)
+		}
+	}
+}
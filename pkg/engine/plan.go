@@ -0,0 +1,381 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNotCompiled       = errors.New("flow is not part of the plan")
+	ErrNoCalendarAction  = errors.New("action cannot be used in before or after flows")
+	ErrUnknownDefinition = errors.New("unknown definition")
+	ErrInvalidCase       = errors.New("case requires either 'case' or 'match'")
+	ErrNoCalendarVerdict = errors.New("return verdicts cannot be used in before or after flows")
+	ErrInvalidCondition  = errors.New("'if' and 'unless' can't be used together")
+)
+
+// scope specifies if flows run for every event or once for the whole calendar
+type scope int
+
+const (
+	scopeEvent scope = iota
+	scopeCalendar
+)
+
+// env returns the expression environment type for the scope
+func (s scope) env() interface{} {
+	if s == scopeCalendar {
+		return new(environ.CalendarEnvironment)
+	}
+	return new(environ.ExprEnvironment)
+}
+
+// planKey identifies a compiled flow.
+// Flows of definitions can be compiled for both scopes if they are used in before / after flows and in flows.
+type planKey struct {
+	flow  model.Flow
+	scope scope
+}
+
+type definitionKey struct {
+	name  string
+	scope scope
+}
+
+// FlowError is an error which occurred at a specific flow, e.g. `flows[1].then[0]`
+type FlowError struct {
+	Path string
+	Err  error
+}
+
+func (f *FlowError) Error() string {
+	return f.Path + ": " + f.Err.Error()
+}
+
+func (f *FlowError) Unwrap() error {
+	return f.Err
+}
+
+// plannedSwitch is a SwitchFlow with its compiled expression and the compiled patterns of its cases.
+// patterns[i] is nil if the case compares values.
+type plannedSwitch struct {
+	program  *vm.Program
+	patterns []*regexp.Regexp
+}
+
+// plannedCondition is a compiled condition.
+// Expressions have a program, groups (all, any, not) have children.
+type plannedCondition struct {
+	expression string
+	program    *vm.Program
+	group      string
+	children   []*plannedCondition
+}
+
+// plannedAction is an ActionFlow with its resolved action and pre-compiled `with` expressions.
+// calendarAction is set instead of action for before and after flows.
+type plannedAction struct {
+	action         actions.Action
+	calendarAction actions.CalendarAction
+	programs       map[string]*vm.Program
+}
+
+// Plan contains flows with all of their expressions compiled.
+// A plan is created once per profile and can be used for any number of events.
+type Plan struct {
+	Flows model.Flows
+	// Before and After run once for the whole calendar
+	Before model.Flows
+	After  model.Flows
+
+	definitions model.Definitions
+	params      model.Params
+
+	conditions map[planKey]*plannedCondition
+	debugs     map[planKey]*vm.Program
+	actions    map[planKey]*plannedAction
+	loops      map[planKey]*vm.Program
+	switches   map[planKey]*plannedSwitch
+	// compiled contains all definitions which were compiled (because they were used)
+	compiled map[definitionKey]bool
+	// strict enables the schema checks of CompileOptions
+	strict bool
+}
+
+func newPlan() *Plan {
+	return &Plan{
+		conditions: make(map[planKey]*plannedCondition),
+		debugs:     make(map[planKey]*vm.Program),
+		actions:    make(map[planKey]*plannedAction),
+		loops:      make(map[planKey]*vm.Program),
+		switches:   make(map[planKey]*plannedSwitch),
+		compiled:   make(map[definitionKey]bool),
+	}
+}
+
+// Compile walks all flows and compiles every expression.
+// All errors are collected and returned at once.
+func Compile(flows model.Flows) (*Plan, error) {
+	p := newPlan()
+	p.Flows = flows
+	var errs []error
+	p.compileFlows("flows", scopeEvent, flows, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// CompileOptions change the checks done while compiling a profile
+type CompileOptions struct {
+	// Strict checks the `with` values of all actions against their schema,
+	// e.g. unknown keys or values of the wrong type fail the compilation.
+	Strict bool
+}
+
+// CompileProfile compiles the flows as well as the before and after flows of a profile.
+// Definitions are compiled when they are used.
+func CompileProfile(profile *model.Profile) (*Plan, error) {
+	return CompileProfileWith(profile, CompileOptions{})
+}
+
+// CompileProfileWith compiles a profile like CompileProfile using the options
+func CompileProfileWith(profile *model.Profile, opts CompileOptions) (*Plan, error) {
+	p := newPlan()
+	p.strict = opts.Strict
+	p.Flows, p.Before, p.After = profile.Flows, profile.Before, profile.After
+	p.definitions = profile.Definitions
+	p.params = profile.Params
+	var errs []error
+	p.compileFlows("before", scopeCalendar, profile.Before, &errs)
+	p.compileFlows("flows", scopeEvent, profile.Flows, &errs)
+	p.compileFlows("after", scopeCalendar, profile.After, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+func (p *Plan) compileFlows(path string, s scope, flows model.Flows, errs *[]error) {
+	for i, flow := range flows {
+		p.compileFlow(fmt.Sprintf("%s[%d]", path, i), s, flow, errs)
+	}
+}
+
+func (p *Plan) compileFlow(path string, s scope, flow model.Flow, errs *[]error) {
+	fail := func(err error) {
+		*errs = append(*errs, &FlowError{Path: path, Err: err})
+	}
+	switch f := flow.(type) {
+	case *model.ReturnFlow:
+		if s == scopeCalendar && f.Return.Verdict != "" {
+			fail(ErrNoCalendarVerdict)
+		}
+	case *model.DebugFlow:
+		// evaluated debug messages can start with "$"
+		if str, ok := f.Debug.(string); ok && strings.HasPrefix(str, "$ ") {
+			prog, err := expr.Compile(str[2:], expr.Env(s.env()))
+			if err != nil {
+				fail(fmt.Errorf("expr compile err: %v", err))
+				return
+			}
+			p.debugs[planKey{f, s}] = prog
+		}
+	case *model.ConditionFlow:
+		if len(f.Condition) > 0 && len(f.Unless) > 0 {
+			fail(ErrInvalidCondition)
+		} else {
+			p.conditions[planKey{f, s}] = compileConditionFlow(f, s, fail)
+		}
+		p.compileFlows(path+".then", s, f.Then, errs)
+		p.compileFlows(path+".else", s, f.Else, errs)
+	case *model.ActionFlow:
+		p.checkParams(f.With, fail)
+		if s == scopeCalendar {
+			p.compileCalendarAction(f, fail)
+			return
+		}
+		act := actions.Find(f.FlowIdentifier)
+		if act == nil {
+			fail(errors.New("invalid flow identifier: " + f.FlowIdentifier))
+			return
+		}
+		p.checkSchema(actions.SchemaOf(act), f.With, fail)
+		planned := &plannedAction{action: act}
+		if c, ok := act.(actions.Compiler); ok {
+			programs, err := c.Compile(f.With)
+			if err != nil {
+				fail(err)
+				return
+			}
+			checkExpressionParams(f.With, programs, fail)
+			planned.programs = programs
+		}
+		p.actions[planKey{f, s}] = planned
+	case *model.ForeachFlow:
+		prog, err := expr.Compile(f.Foreach, expr.Env(s.env()))
+		if err != nil {
+			fail(fmt.Errorf("expr compile err: %v", err))
+		} else {
+			p.loops[planKey{f, s}] = prog
+		}
+		p.compileFlows(path+".flows", s, f.Flows, errs)
+	case *model.SwitchFlow:
+		planned := &plannedSwitch{patterns: make([]*regexp.Regexp, len(f.Cases))}
+		prog, err := expr.Compile(f.Switch, expr.Env(s.env()))
+		if err != nil {
+			fail(fmt.Errorf("expr compile err: %v", err))
+		}
+		planned.program = prog
+		for i, c := range f.Cases {
+			casePath := fmt.Sprintf("%s.cases[%d]", path, i)
+			if (c.Case == nil) == (c.Match == "") {
+				*errs = append(*errs, &FlowError{Path: casePath, Err: ErrInvalidCase})
+			} else if c.Match != "" {
+				if planned.patterns[i], err = regexp.Compile(c.Match); err != nil {
+					*errs = append(*errs, &FlowError{Path: casePath, Err: fmt.Errorf("invalid pattern: %v", err)})
+				}
+			}
+			p.compileFlows(casePath+".then", s, c.Then, errs)
+		}
+		p.compileFlows(path+".default", s, f.Default, errs)
+		p.switches[planKey{f, s}] = planned
+	case *model.TryFlow:
+		p.compileFlows(path+".try", s, f.Try, errs)
+		p.compileFlows(path+".catch", s, f.Catch, errs)
+	case *model.UseFlow:
+		p.checkParams(f.With, fail)
+		flows, ok := p.definitions[f.Use]
+		if !ok {
+			fail(fmt.Errorf("%w: %s", ErrUnknownDefinition, f.Use))
+			return
+		}
+		key := definitionKey{f.Use, s}
+		if !p.compiled[key] {
+			// definitions cannot be recursive, this is checked when parsing
+			p.compiled[key] = true
+			p.compileFlows("definitions."+f.Use, s, flows, errs)
+		}
+	}
+}
+
+// compileConditionFlow compiles the conditions of the flow to a single group.
+// The conditions are combined using the operator of the flow (AND by default), unless negates them.
+func compileConditionFlow(f *model.ConditionFlow, s scope, fail func(err error)) *plannedCondition {
+	group := model.ConditionAll
+	// without conditions, the flow runs the else branch
+	if strings.ToUpper(f.Operator) == "OR" || (len(f.Condition) == 0 && len(f.Unless) == 0) {
+		group = model.ConditionAny
+	}
+	conditions := f.Condition
+	if len(f.Unless) > 0 {
+		conditions = f.Unless
+	}
+	planned := &plannedCondition{group: group, children: compileConditions(conditions, s, fail)}
+	if len(f.Unless) > 0 {
+		planned = &plannedCondition{group: model.ConditionNot, children: []*plannedCondition{planned}}
+	}
+	return planned
+}
+
+func compileConditions(conditions model.Conditions, s scope, fail func(err error)) []*plannedCondition {
+	res := make([]*plannedCondition, len(conditions))
+	for i, c := range conditions {
+		res[i] = compileCondition(c, s, fail)
+	}
+	return res
+}
+
+func compileCondition(c *model.Condition, s scope, fail func(err error)) *plannedCondition {
+	planned := &plannedCondition{group: c.Group()}
+	switch planned.group {
+	case model.ConditionNot:
+		planned.children = []*plannedCondition{compileCondition(c.Not, s, fail)}
+	case model.ConditionAll, model.ConditionAny:
+		children := c.All
+		if planned.group == model.ConditionAny {
+			children = c.Any
+		}
+		if len(children) == 0 {
+			fail(fmt.Errorf("%w: empty '%s' group", model.ErrInvalidCondition, planned.group))
+		}
+		planned.children = compileConditions(children, s, fail)
+	default:
+		planned.expression = c.Expr
+		prog, err := expr.Compile(c.Expr, expr.Env(s.env()), expr.AsBool())
+		if err != nil {
+			fail(fmt.Errorf("expr compile err: %v", err))
+		}
+		planned.program = prog
+	}
+	return planned
+}
+
+// checkParams checks if all parameters referenced in with are declared in the profile
+func (p *Plan) checkParams(with map[string]interface{}, fail func(err error)) {
+	for _, name := range referencedParams(with) {
+		if _, ok := p.params[name]; !ok {
+			fail(fmt.Errorf("%w: %s", ErrUnknownParam, name))
+		}
+	}
+}
+
+// checkExpressionParams rejects parameter references in expressions (keys starting with "$").
+// Expressions are compiled once per profile, so the references would never be replaced.
+func checkExpressionParams(with map[string]interface{}, programs map[string]*vm.Program, fail func(err error)) {
+	keys := make([]string, 0, len(programs))
+	for k := range programs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasPrefix(k, "$") && len(referencedParams(with[k])) > 0 {
+			fail(fmt.Errorf("%w: '%s'", ErrParamInExpression, k))
+		}
+	}
+}
+
+// checkSchema checks the `with` values of an action if the plan is compiled strictly.
+// Values referencing parameters are only known at runtime and are not checked.
+func (p *Plan) checkSchema(schema *actions.Schema, with map[string]interface{}, fail func(err error)) {
+	if !p.strict || schema == nil {
+		return
+	}
+	for _, err := range schema.Validate(with, func(value interface{}) bool {
+		return len(referencedParams(value)) > 0
+	}) {
+		fail(err)
+	}
+}
+
+func (p *Plan) compileCalendarAction(f *model.ActionFlow, fail func(err error)) {
+	act := actions.FindCalendar(f.FlowIdentifier)
+	if act == nil {
+		if actions.Find(f.FlowIdentifier) != nil {
+			fail(fmt.Errorf("%w: %s", ErrNoCalendarAction, f.FlowIdentifier))
+		} else {
+			fail(errors.New("invalid flow identifier: " + f.FlowIdentifier))
+		}
+		return
+	}
+	p.checkSchema(actions.SchemaOf(act), f.With, fail)
+	planned := &plannedAction{calendarAction: act}
+	if c, ok := act.(actions.CalendarCompiler); ok {
+		programs, err := c.CompileCalendar(f.With)
+		if err != nil {
+			fail(err)
+			return
+		}
+		checkExpressionParams(f.With, programs, fail)
+		planned.programs = programs
+	}
+	p.actions[planKey{f, scopeCalendar}] = planned
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEvent(id, summary string, start time.Time) *ics.VEvent {
+	event := ics.NewEvent(id)
+	event.SetSummary(summary)
+	event.SetStartAt(start)
+	event.SetEndAt(start.Add(time.Hour))
+	return event
+}
+
+func TestCompileCollectsErrors(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - if: 'Event.Summary() =='
+  - do: actions/unknown
+  - if: 'true'
+    then:
+      - debug: '$ Event.Nope()'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(profile.Flows)
+	if err == nil {
+		t.Fatal("expected compile error")
+	}
+	var flowErr *FlowError
+	if !errors.As(err, &flowErr) {
+		t.Fatalf("expected FlowError, got %T", err)
+	}
+	for _, path := range []string{"flows[0]", "flows[1]", "flows[2].then[0]"} {
+		if !strings.Contains(err.Error(), path+":") {
+			t.Fatalf("expected error for %s, got %v", path, err)
+		}
+	}
+}
+
+func TestModifyCalendarWithPlan(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - do: ctx/set
+    with:
+      $title: 'Upper(Event.Summary())'
+  - if: 'Context.title == "KEEP"'
+    else:
+      - do: filters/filter-out
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Compile(profile.Flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "keep", start))
+	cal.AddVEvent(newTestEvent("b", "drop", start))
+	cal.AddVEvent(newTestEvent("c", "Keep", start))
+
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 2 || events[0].Id() != "a" || events[1].Id() != "c" {
+		t.Fatalf("unexpected events after modify: %d", len(events))
+	}
+}
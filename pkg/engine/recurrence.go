@@ -0,0 +1,395 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"github.com/darmiel/ralf/pkg/model"
+	"github.com/teambition/rrule-go"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxOccurrences is the maximum number of occurrences generated for a single recurring event
+	MaxOccurrences = 1000
+
+	// recurrenceCheckInterval is the number of generated occurrences after which the context is checked
+	recurrenceCheckInterval = 1000
+
+	defaultRecurrencePast   = 30 * 24 * time.Hour
+	defaultRecurrenceFuture = 365 * 24 * time.Hour
+)
+
+var (
+	ErrUnknownRecurrenceMode = errors.New("unknown recurrence mode")
+	ErrTooManyOccurrences    = errors.New("too many occurrences")
+)
+
+// componentPropertyRecurrenceId is missing in golang-ical
+const componentPropertyRecurrenceId = ics.ComponentProperty(ics.PropertyRecurrenceId)
+
+const (
+	icalDate          = "20060102"
+	icalDateTimeLocal = "20060102T150405"
+	icalDateTimeUTC   = "20060102T150405Z"
+)
+
+// recurringSeries is a recurring event whose occurrences are processed by flows in exdate mode
+type recurringSeries struct {
+	master *ics.VEvent
+	// occurrences contains the generated occurrences in order
+	occurrences []*ics.VEvent
+	// snapshots contains the properties of the generated occurrences before the flows ran
+	snapshots map[*ics.VEvent]map[string][]string
+	// overrides contains all events of the source calendar with a RECURRENCE-ID for this series
+	overrides []*ics.VEvent
+}
+
+func isRecurring(event *ics.VEvent) bool {
+	if event.GetProperty(componentPropertyRecurrenceId) != nil {
+		return false
+	}
+	return event.GetProperty(ics.ComponentPropertyRrule) != nil ||
+		event.GetProperty(ics.ComponentPropertyRdate) != nil
+}
+
+// parsePropertyTime parses a DATE or DATE-TIME value with respect to the TZID parameter
+func parsePropertyTime(value string, params map[string][]string, defaultLoc *time.Location) (time.Time, error) {
+	loc := defaultLoc
+	if tzid, ok := params["TZID"]; ok && len(tzid) == 1 {
+		var err error
+		if loc, err = time.LoadLocation(tzid[0]); err != nil {
+			return time.Time{}, err
+		}
+	}
+	switch len(value) {
+	case len(icalDate):
+		return time.ParseInLocation(icalDate, value, loc)
+	case len(icalDateTimeLocal):
+		return time.ParseInLocation(icalDateTimeLocal, value, loc)
+	default:
+		return time.Parse(icalDateTimeUTC, value)
+	}
+}
+
+// formatPropertyTime formats t in the same format as the property like
+func formatPropertyTime(like *ics.IANAProperty, t time.Time) string {
+	if v, ok := like.ICalParameters["VALUE"]; ok && len(v) == 1 && v[0] == "DATE" {
+		return t.Format(icalDate)
+	}
+	if strings.HasSuffix(like.Value, "Z") {
+		return t.UTC().Format(icalDateTimeUTC)
+	}
+	return t.Format(icalDateTimeLocal)
+}
+
+// propertyParameters returns the parameters of a property (sorted by key) as ics.PropertyParameter
+func propertyParameters(prop *ics.IANAProperty) []ics.PropertyParameter {
+	keys := make([]string, 0, len(prop.ICalParameters))
+	for k := range prop.ICalParameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]ics.PropertyParameter, len(keys))
+	for i, k := range keys {
+		res[i] = &ics.KeyValues{Key: k, Value: prop.ICalParameters[k]}
+	}
+	return res
+}
+
+// occurrencesOf returns the start times of all occurrences of a recurring event within [from, until].
+// All RRULEs and RDATEs are combined, EXDATEs are excluded.
+// The expansion stops after MaxOccurrences or when ctx is done.
+func occurrencesOf(ctx context.Context, event *ics.VEvent, from, until time.Time) ([]time.Time, error) {
+	start, err := event.GetStartAt()
+	if err != nil {
+		return nil, fmt.Errorf("get start at err: %v", err)
+	}
+	// DTSTART is always the first occurrence
+	candidates := []time.Time{start}
+	excluded := make(map[int64]bool)
+	for _, prop := range event.Properties {
+		switch ics.ComponentProperty(prop.IANAToken) {
+		case ics.ComponentPropertyRrule:
+			opt, err := rrule.StrToROptionInLocation(prop.Value, start.Location())
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE: %v", err)
+			}
+			opt.Dtstart = start
+			rule, err := rrule.NewRRule(*opt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE: %v", err)
+			}
+			times, err := ruleOccurrences(ctx, rule, from, until)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, times...)
+		case ics.ComponentPropertyRdate, ics.ComponentPropertyExdate:
+			for _, value := range strings.Split(prop.Value, ",") {
+				t, err := parsePropertyTime(value, prop.ICalParameters, start.Location())
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %v", prop.IANAToken, err)
+				}
+				if prop.IANAToken == string(ics.ComponentPropertyRdate) {
+					candidates = append(candidates, t)
+				} else {
+					excluded[t.Unix()] = true
+				}
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+	var res []time.Time
+	seen := make(map[int64]bool)
+	for _, t := range candidates {
+		if t.Before(from) || t.After(until) || excluded[t.Unix()] || seen[t.Unix()] {
+			continue
+		}
+		seen[t.Unix()] = true
+		res = append(res, t)
+	}
+	if len(res) > MaxOccurrences {
+		return nil, tooManyOccurrences(from, until)
+	}
+	return res, nil
+}
+
+// ruleOccurrences returns the occurrences of a rule within [from, until].
+// It returns ErrTooManyOccurrences as soon as more than MaxOccurrences are found.
+func ruleOccurrences(ctx context.Context, rule *rrule.RRule, from, until time.Time) ([]time.Time, error) {
+	var res []time.Time
+	next := rule.Iterator()
+	for i := 0; ; i++ {
+		// occurrences before the window are skipped, so the context is checked regularly
+		if i%recurrenceCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, &LimitError{Limit: LimitDeadline, Err: err}
+			}
+		}
+		t, ok := next()
+		if !ok || t.After(until) {
+			return res, nil
+		}
+		if t.Before(from) {
+			continue
+		}
+		if res = append(res, t); len(res) > MaxOccurrences {
+			return nil, tooManyOccurrences(from, until)
+		}
+	}
+}
+
+func tooManyOccurrences(from, until time.Time) error {
+	return fmt.Errorf("%w: more than %d between %s and %s, shorten the recurrence window",
+		ErrTooManyOccurrences, MaxOccurrences, from.Format(time.DateOnly), until.Format(time.DateOnly))
+}
+
+// newOccurrence creates a copy of a recurring event starting at t
+func newOccurrence(master *ics.VEvent, t time.Time) *ics.VEvent {
+	occ := util.CloneEvent(master)
+	start, _ := master.GetStartAt()
+	t = t.In(start.Location())
+	for i := len(occ.Properties) - 1; i >= 0; i-- {
+		prop := &occ.Properties[i]
+		switch ics.ComponentProperty(prop.IANAToken) {
+		case ics.ComponentPropertyRrule, ics.ComponentPropertyRdate,
+			ics.ComponentPropertyExdate, ics.ComponentPropertyExrule:
+			occ.Properties = append(occ.Properties[:i], occ.Properties[i+1:]...)
+		case ics.ComponentPropertyDtStart:
+			prop.Value = formatPropertyTime(prop, t)
+		case ics.ComponentPropertyDtEnd:
+			if end, err := master.GetEndAt(); err == nil {
+				prop.Value = formatPropertyTime(prop, t.Add(end.Sub(start)))
+			}
+		}
+	}
+	return occ
+}
+
+// recurrenceIDs returns the RECURRENCE-ID of all overrides as unix timestamps.
+// Floating RECURRENCE-IDs are in the location of the series.
+func recurrenceIDs(overrides []*ics.VEvent, loc *time.Location) map[int64]bool {
+	res := make(map[int64]bool)
+	for _, o := range overrides {
+		prop := o.GetProperty(componentPropertyRecurrenceId)
+		if t, err := parsePropertyTime(prop.Value, prop.ICalParameters, loc); err == nil {
+			res[t.Unix()] = true
+		}
+	}
+	return res
+}
+
+// prepareRecurrences replaces recurring events in the calendar with their occurrences.
+// In exdate mode, the returned series must be passed to finishRecurrences after the flows ran.
+func prepareRecurrences(ctx context.Context, rec *model.Recurrence, cal *ics.Calendar, now time.Time) ([]*recurringSeries, error) {
+	if rec.Mode != model.RecurrenceExpand && rec.Mode != model.RecurrenceExDate {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRecurrenceMode, rec.Mode)
+	}
+	past, future := time.Duration(rec.Past), time.Duration(rec.Future)
+	if past == 0 {
+		past = defaultRecurrencePast
+	}
+	if future == 0 {
+		future = defaultRecurrenceFuture
+	}
+	from, until := now.Add(-past), now.Add(future)
+
+	// collect overrides of recurring events
+	overrides := make(map[string][]*ics.VEvent)
+	for _, c := range cal.Components {
+		if event, ok := c.(*ics.VEvent); ok && event.GetProperty(componentPropertyRecurrenceId) != nil {
+			overrides[event.Id()] = append(overrides[event.Id()], event)
+		}
+	}
+
+	var (
+		series     []*recurringSeries
+		components []ics.Component
+		// expanded contains the location of expanded series by UID
+		expanded = make(map[string]*time.Location)
+	)
+	for _, c := range cal.Components {
+		event, ok := c.(*ics.VEvent)
+		if !ok || !isRecurring(event) {
+			components = append(components, c)
+			continue
+		}
+		times, err := occurrencesOf(ctx, event, from, until)
+		if err != nil {
+			return nil, fmt.Errorf("cannot expand %s: %w", event.Id(), err)
+		}
+		start, _ := event.GetStartAt()
+		// overrides replace the occurrence with the same RECURRENCE-ID
+		overridden := recurrenceIDs(overrides[event.Id()], start.Location())
+		s := &recurringSeries{
+			master:    event,
+			snapshots: make(map[*ics.VEvent]map[string][]string),
+			overrides: overrides[event.Id()],
+		}
+		dtStart := event.GetProperty(ics.ComponentPropertyDtStart)
+		for _, t := range times {
+			if overridden[t.Unix()] {
+				continue
+			}
+			occ := newOccurrence(event, t)
+			if rec.Mode == model.RecurrenceExpand {
+				occ.SetProperty(ics.ComponentPropertyUniqueId, event.Id()+"-"+t.UTC().Format(icalDateTimeUTC))
+			} else {
+				occ.SetProperty(componentPropertyRecurrenceId, formatPropertyTime(dtStart, t), propertyParameters(dtStart)...)
+				s.occurrences = append(s.occurrences, occ)
+				s.snapshots[occ] = snapshotProperties(&occ.ComponentBase)
+			}
+			components = append(components, occ)
+		}
+		if rec.Mode == model.RecurrenceExpand {
+			expanded[event.Id()] = start.Location()
+		} else {
+			series = append(series, s)
+		}
+	}
+
+	// in expand mode, overrides are converted to standalone events
+	if rec.Mode == model.RecurrenceExpand {
+		for _, c := range components {
+			event, ok := c.(*ics.VEvent)
+			if !ok {
+				continue
+			}
+			loc, ok := expanded[event.Id()]
+			if !ok {
+				continue
+			}
+			prop := event.GetProperty(componentPropertyRecurrenceId)
+			if prop == nil {
+				continue
+			}
+			if t, err := parsePropertyTime(prop.Value, prop.ICalParameters, loc); err == nil {
+				event.SetProperty(ics.ComponentPropertyUniqueId, event.Id()+"-"+t.UTC().Format(icalDateTimeUTC))
+			}
+			removeProperty(&event.ComponentBase, componentPropertyRecurrenceId)
+		}
+	}
+
+	cal.Components = components
+	return series, nil
+}
+
+// finishRecurrences restores the recurring events after the flows ran in exdate mode.
+// Filtered out occurrences and overrides are excluded using EXDATE,
+// changed occurrences are kept as overrides and unchanged occurrences are removed.
+func finishRecurrences(series []*recurringSeries, cal *ics.Calendar) {
+	if len(series) == 0 {
+		return
+	}
+	kept := make(map[*ics.VEvent]bool)
+	for _, c := range cal.Components {
+		if event, ok := c.(*ics.VEvent); ok {
+			kept[event] = true
+		}
+	}
+	owner := make(map[*ics.VEvent]*recurringSeries)
+	for _, s := range series {
+		for _, occ := range s.occurrences {
+			owner[occ] = s
+		}
+		for _, o := range s.overrides {
+			if !kept[o] {
+				prop := o.GetProperty(componentPropertyRecurrenceId)
+				s.master.AddExdate(prop.Value, propertyParameters(prop)...)
+			}
+		}
+	}
+
+	var (
+		components []ics.Component
+		placed     = make(map[*recurringSeries]bool)
+	)
+	place := func(s *recurringSeries) {
+		if !placed[s] {
+			placed[s] = true
+			components = append(components, s.master)
+		}
+	}
+	for _, c := range cal.Components {
+		event, ok := c.(*ics.VEvent)
+		if !ok {
+			components = append(components, c)
+			continue
+		}
+		s, ok := owner[event]
+		if !ok {
+			components = append(components, c)
+			continue
+		}
+		place(s)
+		if len(diffProperties(s.snapshots[event], snapshotProperties(&event.ComponentBase))) > 0 {
+			components = append(components, event)
+		}
+	}
+	for _, s := range series {
+		for _, occ := range s.occurrences {
+			if !kept[occ] {
+				prop := occ.GetProperty(componentPropertyRecurrenceId)
+				s.master.AddExdate(prop.Value, propertyParameters(prop)...)
+			}
+		}
+		place(s)
+	}
+	cal.Components = components
+}
+
+func removeProperty(base *ics.ComponentBase, property ics.ComponentProperty) {
+	for i := len(base.Properties) - 1; i >= 0; i-- {
+		if base.Properties[i].IANAToken == string(property) {
+			base.Properties = append(base.Properties[:i], base.Properties[i+1:]...)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const recurringCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:lecture\r\n" +
+	"SUMMARY:Lecture\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20230102T100000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20230102T113000\r\n" +
+	"RRULE:FREQ=DAILY;COUNT=7\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:lecture\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20230103T100000\r\n" +
+	"SUMMARY:Moved Lecture\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20230103T140000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20230103T153000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func runRecurrence(t *testing.T, mode string, flows string) *ics.Calendar {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nflows:\n" + flows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.Recurrence = &model.Recurrence{Mode: mode}
+	plan, err := Compile(profile.Flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err := ics.ParseCalendar(strings.NewReader(recurringCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	series, err := prepareRecurrences(context.Background(), profile.Recurrence, cal, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = modifyEvents(&ContextFlow{Profile: profile}, plan, cal, map[ics.ComponentType]bool{ics.ComponentVEvent: true}); err != nil {
+		t.Fatal(err)
+	}
+	finishRecurrences(series, cal)
+	return cal
+}
+
+func TestRecurrenceExpand(t *testing.T) {
+	cal := runRecurrence(t, model.RecurrenceExpand, `
+  - if: 'Date.IsMonday() or Date.IsTuesday()'
+    else:
+      - do: filters/filter-out
+`)
+	var uids []string
+	for _, e := range cal.Events() {
+		uids = append(uids, e.Id())
+		if e.GetProperty(ics.ComponentPropertyRrule) != nil {
+			t.Fatal("expanded event still has a RRULE")
+		}
+	}
+	// 2023-01-02 is a Monday, the Tuesday occurrence is overridden
+	expected := "lecture-20230102T090000Z,lecture-20230103T090000Z"
+	if strings.Join(uids, ",") != expected {
+		t.Fatalf("expected %s, got %v", expected, uids)
+	}
+}
+
+func TestRecurrenceExDate(t *testing.T) {
+	cal := runRecurrence(t, model.RecurrenceExDate, `
+  - if: 'Date.IsWednesday()'
+    then:
+      - do: filters/filter-out
+  - if: 'Date.IsThursday()'
+    then:
+      - do: actions/regex-replace
+        with:
+          match: 'Lecture'
+          replace: 'Exam'
+          in: [ "summary" ]
+`)
+	events := cal.Events()
+	if len(events) != 3 {
+		t.Fatalf("expected master, override and changed occurrence, got %d events", len(events))
+	}
+	master := events[0]
+	exdate := master.GetProperty(ics.ComponentPropertyExdate)
+	if exdate == nil || exdate.Value != "20230104T100000" {
+		t.Fatalf("expected EXDATE for wednesday, got %+v", exdate)
+	}
+	// the master is placed before its first occurrence
+	changed := events[1]
+	if changed.GetProperty(componentPropertyRecurrenceId).Value != "20230105T100000" ||
+		changed.GetProperty(ics.ComponentPropertySummary).Value != "Exam" {
+		t.Fatal("expected changed thursday occurrence as override")
+	}
+	if events[2].GetProperty(ics.ComponentPropertySummary).Value != "Moved Lecture" {
+		t.Fatal("expected override to be kept")
+	}
+}
+
+func parseEvent(t *testing.T, lines ...string) *ics.VEvent {
+	cal, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\n" +
+		strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal.Events()[0]
+}
+
+func TestOccurrencesMultipleRules(t *testing.T) {
+	event := parseEvent(t,
+		"UID:a",
+		"DTSTART:20230102T100000Z",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=2",
+		"RRULE:FREQ=WEEKLY;BYDAY=WE;COUNT=2",
+		"EXDATE:20230111T100000Z",
+	)
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	times, err := occurrencesOf(context.Background(), event, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var days []string
+	for _, tm := range times {
+		days = append(days, tm.Format("0102"))
+	}
+	if expected := "0102,0104,0109"; strings.Join(days, ",") != expected {
+		t.Fatalf("expected %s, got %v", expected, days)
+	}
+}
+
+func TestOccurrencesWindow(t *testing.T) {
+	// occurrences long after DTSTART are found without walking a limited number of steps
+	event := parseEvent(t, "UID:a", "DTSTART:20000101T000000Z", "RRULE:FREQ=HOURLY")
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	times, err := occurrencesOf(context.Background(), event, from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the window is inclusive on both ends
+	if len(times) != 25 || !times[0].Equal(from) {
+		t.Fatalf("expected 25 occurrences starting at %s, got %v", from, times)
+	}
+	if _, err = occurrencesOf(context.Background(), event, from, from.AddDate(1, 0, 0)); !errors.Is(err, ErrTooManyOccurrences) {
+		t.Fatalf("expected ErrTooManyOccurrences, got %v", err)
+	}
+}
+
+func TestOccurrencesSecondly(t *testing.T) {
+	event := parseEvent(t, "UID:a", "DTSTART:20230101T000000Z", "RRULE:FREQ=SECONDLY")
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	begin := time.Now()
+	// the expansion stops after MaxOccurrences instead of generating every second of the year
+	if _, err := occurrencesOf(context.Background(), event, from, from.AddDate(1, 0, 0)); !errors.Is(err, ErrTooManyOccurrences) {
+		t.Fatalf("expected ErrTooManyOccurrences, got %v", err)
+	}
+	if d := time.Since(begin); d > time.Second {
+		t.Fatalf("expected the expansion to stop early, took %s", d)
+	}
+
+	// occurrences before the window are skipped until the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	later := from.AddDate(10, 0, 0)
+	_, err := occurrencesOf(ctx, event, later, later.Add(time.Minute))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitDeadline {
+		t.Fatalf("expected deadline limit error, got %v", err)
+	}
+}
+
+func TestFloatingRecurrenceID(t *testing.T) {
+	cal, err := ics.ParseCalendar(strings.NewReader(strings.ReplaceAll(recurringCalendar,
+		"RECURRENCE-ID;TZID=Europe/Berlin:20230103T100000", "RECURRENCE-ID:20230103T100000")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &model.Recurrence{Mode: model.RecurrenceExpand}
+	if _, err = prepareRecurrences(context.Background(), rec, cal, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	var uids []string
+	for _, e := range cal.Events() {
+		uids = append(uids, e.Id())
+	}
+	// the override replaces the tuesday occurrence and gets the same UID
+	if len(uids) != 7 || uids[6] != "lecture-20230103T090000Z" || strings.Contains(strings.Join(uids[:6], ","), "20230103") {
+		t.Fatalf("expected override to replace the tuesday occurrence, got %v", uids)
+	}
+}
@@ -1,28 +1,106 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
 	ics "github.com/darmiel/golang-ical"
 	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
 	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"sync"
+	"time"
 )
 
-func ModifyCalendar(ctx *ContextFlow, flows model.Flows, cal *ics.Calendar) error {
+var (
+	ErrUnknownComponentType = errors.New("unknown component type")
+	ErrUnknownErrorPolicy   = errors.New("unknown on-error policy")
+)
+
+// componentTypes returns the component types processed by the profile (VEVENT by default)
+func componentTypes(profile *model.Profile) (map[ics.ComponentType]bool, error) {
+	if profile == nil || len(profile.Components) == 0 {
+		return map[ics.ComponentType]bool{ics.ComponentVEvent: true}, nil
+	}
+	res := make(map[ics.ComponentType]bool)
+	for _, c := range profile.Components {
+		t := ics.ComponentType(strings.ToUpper(c))
+		switch t {
+		case ics.ComponentVEvent, ics.ComponentVTodo, ics.ComponentVJournal:
+			res[t] = true
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownComponentType, c)
+		}
+	}
+	return res, nil
+}
+
+// processedComponent returns the wrapped component if its type is processed by the flows, otherwise nil
+func processedComponent(c ics.Component, types map[ics.ComponentType]bool) *environ.Component {
+	if component := environ.NewComponent(c); component != nil && types[component.Type] {
+		return component
+	}
+	return nil
+}
+
+// ModifyCalendar runs the plan for every event in the calendar and removes filtered out events.
+// The source tags of MergeSources are removed afterwards.
+func ModifyCalendar(ctx *ContextFlow, plan *Plan, cal *ics.Calendar) error {
+	defer stripSourceTags(cal)
+	types, err := componentTypes(ctx.Profile)
+	if err != nil {
+		return err
+	}
+	// every calendar is a new run
+	ctx.resetLimits()
+	ctx.initOutput()
+	switch policy := ctx.onError(); policy {
+	case model.OnErrorFail, model.OnErrorSkipEvent, model.OnErrorKeepEvent:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownErrorPolicy, policy)
+	}
+	if len(plan.Before) > 0 {
+		if err = ctx.RunCalendarFlows(cal, plan, ScopeBefore, plan.Before); err != nil {
+			return fmt.Errorf("before: %w", err)
+		}
+	}
+	var series []*recurringSeries
+	if ctx.Profile != nil && ctx.Profile.Recurrence != nil {
+		if series, err = prepareRecurrences(ctx.limits.ctx, ctx.Profile.Recurrence, cal, time.Now()); err != nil {
+			return err
+		}
+	}
+	if err = modifyEvents(ctx, plan, cal, types); err != nil {
+		return err
+	}
+	finishRecurrences(series, cal)
+	if len(plan.After) > 0 {
+		if err = ctx.RunCalendarFlows(cal, plan, ScopeAfter, plan.After); err != nil {
+			return fmt.Errorf("after: %w", err)
+		}
+	}
+	return nil
+}
+
+func modifyEvents(ctx *ContextFlow, plan *Plan, cal *ics.Calendar, types map[ics.ComponentType]bool) error {
+	if ctx.Workers > 1 {
+		return modifyCalendarParallel(ctx, plan, cal, types)
+	}
+
 	// get components from calendar (events) and copy to slice for later modifications
 	cc := cal.Components[:]
 
 	// start from behind so we can remove from slice
 	for i := len(cc) - 1; i >= 0; i-- {
-		event, ok := cc[i].(*ics.VEvent)
-		if !ok {
+		event := processedComponent(cc[i], types)
+		if event == nil {
 			continue
 		}
-		var fact actions.ActionMessage
-		fact, err := ctx.RunMultiFlows(event, flows)
-		if err != nil && err != ErrExited {
+		fact, err := ctx.RunPlan(event, plan)
+		if fact, err = ctx.handleEventError(event, fact, err); err != nil {
 			return err
 		}
-		switch fact.(type) {
-		case actions.FilterOutActionMessage, *actions.FilterOutActionMessage:
+		if isFilteredOut(fact) {
 			cc = append(cc[:i], cc[i+1:]...) // remove event from components
 		}
 	}
@@ -30,3 +108,85 @@ func ModifyCalendar(ctx *ContextFlow, flows model.Flows, cal *ics.Calendar) erro
 	cal.Components = cc
 	return nil
 }
+
+func isFilteredOut(fact actions.ActionMessage) bool {
+	switch fact.(type) {
+	case actions.FilterOutActionMessage, *actions.FilterOutActionMessage:
+		return true
+	}
+	return false
+}
+
+// isFinal returns true if the verdict can't be changed by later flows
+func isFinal(fact actions.ActionMessage) bool {
+	switch f := fact.(type) {
+	case *actions.FilterInActionMessage:
+		return f.Final
+	case *actions.FilterOutActionMessage:
+		return f.Final
+	}
+	return false
+}
+
+// eventResult is the outcome of running the flows for a single event
+type eventResult struct {
+	event  *environ.Component
+	fact   actions.ActionMessage
+	debugs []interface{}
+	trace  *EventTrace
+	err    error
+}
+
+// modifyCalendarParallel distributes the events to ctx.Workers goroutines.
+// Results and debug messages are merged in the same order as the sequential run.
+func modifyCalendarParallel(ctx *ContextFlow, plan *Plan, cal *ics.Calendar, types map[ics.ComponentType]bool) error {
+	cc := cal.Components
+	results := make([]*eventResult, len(cc))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < ctx.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := &eventResult{event: processedComponent(cc[i], types)}
+				res.fact, res.trace, res.err = ctx.runEvent(res.event, plan, &res.debugs)
+				results[i] = res
+			}
+		}()
+	}
+	for i, c := range cc {
+		if processedComponent(c, types) != nil {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// the sequential run starts from behind, so merge debug messages, traces and errors in that order
+	for i := len(results) - 1; i >= 0; i-- {
+		res := results[i]
+		if res == nil {
+			continue
+		}
+		ctx.Debugs = append(ctx.Debugs, res.debugs...)
+		if res.trace != nil {
+			ctx.Traces = append(ctx.Traces, res.trace)
+		}
+		var err error
+		if res.fact, err = ctx.handleEventError(res.event, res.fact, res.err); err != nil {
+			return err
+		}
+	}
+
+	kept := make([]ics.Component, 0, len(cc))
+	for i, c := range cc {
+		if res := results[i]; res != nil && isFilteredOut(res.fact) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	cal.Components = kept
+	return nil
+}
@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModifyCalendarParallelMatchesSequential(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - debug: '$ Event.Summary()'
+  - if: 'Date.IsMonday()'
+    else:
+      - do: filters/filter-out
+  - do: actions/regex-replace
+    with:
+      match: 'Event'
+      replace: 'Lecture'
+      in: [ "summary" ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Compile(profile.Flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := func() *ics.Calendar {
+		cal := ics.NewCalendar()
+		start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+		for i := 0; i < 100; i++ {
+			cal.AddVEvent(newTestEvent(fmt.Sprint(i), fmt.Sprintf("Event %d", i), start.Add(time.Duration(i)*24*time.Hour)))
+		}
+		return cal
+	}
+
+	seqCal, parCal := build(), build()
+	seq := &ContextFlow{Profile: profile, EnableDebug: true}
+	par := &ContextFlow{Profile: profile, EnableDebug: true, Workers: 8}
+	if err = ModifyCalendar(seq, plan, seqCal); err != nil {
+		t.Fatal(err)
+	}
+	if err = ModifyCalendar(par, plan, parCal); err != nil {
+		t.Fatal(err)
+	}
+
+	if seqCal.Serialize() != parCal.Serialize() {
+		t.Fatal("parallel output differs from sequential output")
+	}
+	if fmt.Sprint(seq.Debugs) != fmt.Sprint(par.Debugs) {
+		t.Fatalf("debug messages differ:\n%v\n%v", seq.Debugs, par.Debugs)
+	}
+}
+
+func TestModifyCalendarTodos(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+components: [ vevent, vtodo ]
+flows:
+  - if: 'Component.Type == "VTODO" and (PercentComplete == 100 or Completed.IsSet())'
+    then:
+      - do: filters/filter-out
+  - if: 'Component.Type == "VTODO" and Due.IsFriday()'
+    then:
+      - do: actions/regex-replace
+        with:
+          match: '^'
+          replace: '[Friday] '
+          in: [ "summary" ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Compile(profile.Flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTODO\r\nUID:done\r\nSUMMARY:Done\r\nPERCENT-COMPLETE:100\r\nEND:VTODO\r\n" +
+		"BEGIN:VTODO\r\nUID:open\r\nSUMMARY:Assignment\r\nDUE:20230106T120000Z\r\nEND:VTODO\r\n" +
+		"BEGIN:VJOURNAL\r\nUID:journal\r\nEND:VJOURNAL\r\n" +
+		"END:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Components) != 2 {
+		t.Fatalf("expected 2 components, got %d", len(cal.Components))
+	}
+	todo, ok := cal.Components[0].(*ics.VTodo)
+	if !ok || todo.GetProperty(ics.ComponentPropertySummary).Value != "[Friday] Assignment" {
+		t.Fatal("expected renamed todo")
+	}
+}
+
+// legacyEventAction only supports events using the deprecated Context.Event and has no schema
+type legacyEventAction struct{}
+
+func (*legacyEventAction) Identifier() string {
+	return "test/legacy-event"
+}
+
+func (*legacyEventAction) Execute(ctx *actions.Context) (actions.ActionMessage, error) {
+	if ctx.Event != nil {
+		ctx.Event.SetSummary("legacy")
+	}
+	return nil, nil
+}
+
+func TestDeprecatedContextEvent(t *testing.T) {
+	if err := actions.Register(new(legacyEventAction)); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+components: [ vevent, vtodo ]
+flows:
+  - do: test/legacy-event
+    with:
+      unchecked: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:event\r\nSUMMARY:Event\r\nEND:VEVENT\r\n" +
+		"BEGIN:VTODO\r\nUID:todo\r\nSUMMARY:Todo\r\nEND:VTODO\r\n" +
+		"END:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	var summaries []string
+	for _, c := range cal.Components {
+		summaries = append(summaries, environ.NewComponent(c).GetProperty(ics.ComponentPropertySummary).Value)
+	}
+	if strings.Join(summaries, ",") != "legacy,Todo" {
+		t.Fatalf("expected only the event to be modified, got %v", summaries)
+	}
+}
+
+func TestModifyCalendarBeforeAfter(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+before:
+  - do: ctx/set
+    with:
+      $name: 'Calendar.Name()'
+flows:
+  - if: 'Context.name == "Uni"'
+    then:
+      - do: actions/regex-replace
+        with:
+          match: '^'
+          replace: 'Uni: '
+          in: [ "summary" ]
+after:
+  - do: calendar/sort
+    with:
+      by: start
+      order: desc
+  - do: calendar/limit
+    with:
+      max: 2
+  - do: calendar/set-property
+    with:
+      property: X-WR-CALNAME
+      $value: 'Calendar.Name() + " (" + String(Calendar.EventCount()) + ")"'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	cal.SetXWRCalName("Uni")
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		cal.AddVEvent(newTestEvent(fmt.Sprint(i), fmt.Sprintf("Event %d", i), start.Add(time.Duration(i)*24*time.Hour)))
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	var summaries []string
+	for _, e := range cal.Events() {
+		summaries = append(summaries, e.GetProperty(ics.ComponentPropertySummary).Value)
+	}
+	if expected := "Uni: Event 2,Uni: Event 1"; strings.Join(summaries, ",") != expected {
+		t.Fatalf("expected %s, got %v", expected, summaries)
+	}
+	if !strings.Contains(cal.Serialize(), "X-WR-CALNAME:Uni (2)") {
+		t.Fatal("expected calendar name to be updated")
+	}
+}
+
+func TestCompileProfileRejectsEventActions(t *testing.T) {
+	_, err := CompileProfile(&model.Profile{
+		After: model.Flows{&model.ActionFlow{FlowIdentifier: "filters/filter-out"}},
+	})
+	if !errors.Is(err, ErrNoCalendarAction) {
+		t.Fatalf("expected ErrNoCalendarAction, got %v", err)
+	}
+}
+
+func TestModifyCalendarOutput(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - debug: '$ "checking " + Event.Summary()'
+  - do: actions/set-property
+    with:
+      property: location
+      value: Room 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ics.NewCalendar()
+	for i := 0; i < 10; i++ {
+		cal.AddVEvent(newTestEvent(fmt.Sprint(i), fmt.Sprint("Lecture ", i), time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	}
+	var out bytes.Buffer
+	cp := &ContextFlow{Profile: profile, EnableDebug: true, Verbose: true, Workers: 4, Output: &out}
+	if err = ModifyCalendar(cp, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	str := out.String()
+	if strings.Count(str, "[DEBUG] checking Lecture") != 10 || strings.Count(str, "[actions/set-property] set LOCATION") != 10 {
+		t.Fatalf("expected debug and verbose messages in output, got:\n%s", str)
+	}
+}
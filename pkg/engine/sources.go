@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"sync"
+)
+
+var (
+	ErrDuplicateSourceName   = errors.New("duplicate source name")
+	ErrUnknownSourceConflict = errors.New("unknown source conflict policy")
+	ErrUIDConflict           = errors.New("sources contain events with the same UID")
+)
+
+// SourceCalendar is the calendar loaded from a source
+type SourceCalendar struct {
+	Name     string
+	Calendar *ics.Calendar
+}
+
+// FetchFunc loads the calendar of a source, e.g. from a cache
+type FetchFunc func(src model.Source) (*ics.Calendar, error)
+
+// sourceNames returns the names of the sources and an error if a name is used more than once
+func sourceNames(sources model.SomeSource) ([]string, error) {
+	names := make([]string, len(sources))
+	seen := make(map[string]bool, len(sources))
+	for i, src := range sources {
+		names[i] = model.SourceName(src)
+		if seen[names[i]] {
+			return nil, fmt.Errorf("%w: %s (set `source-name` for sources of the same type)", ErrDuplicateSourceName, names[i])
+		}
+		seen[names[i]] = true
+	}
+	return names, nil
+}
+
+// FetchSources loads the calendars of all sources in parallel.
+// The calendars are returned in the order of the sources.
+func FetchSources(sources model.SomeSource, fetch FetchFunc) ([]*SourceCalendar, error) {
+	names, err := sourceNames(sources)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*SourceCalendar, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src model.Source) {
+			defer wg.Done()
+			cal, err := fetch(src)
+			if err != nil {
+				errs[i] = fmt.Errorf("source %s: %w", names[i], err)
+				return
+			}
+			res[i] = &SourceCalendar{Name: names[i], Calendar: cal}
+		}(i, src)
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// MergeSources merges the calendars of multiple sources into the calendar of the first source.
+// Events (tasks, journal entries) are tagged with the name of their source (environ.PropertySource),
+// even if there is only one source. ModifyCalendar removes the tags again.
+// Events with a UID which is used by an earlier source are handled by the policy (e.g. model.SourceConflictRename).
+func MergeSources(cals []*SourceCalendar, policy string) (*ics.Calendar, error) {
+	switch policy {
+	case "", model.SourceConflictRename, model.SourceConflictKeepFirst,
+		model.SourceConflictKeepLast, model.SourceConflictFail:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSourceConflict, policy)
+	}
+	if len(cals) == 0 {
+		return nil, model.ErrInvalidLength
+	}
+	merged := &ics.Calendar{
+		CalendarProperties: append([]ics.CalendarProperty(nil), cals[0].Calendar.CalendarProperties...),
+	}
+	timezones := make(map[string]bool)
+	// owners contains the index of the source which added the events with the UID
+	owners := make(map[string]int)
+
+	for i, sc := range cals {
+		for _, c := range sc.Calendar.Components {
+			if tz, ok := c.(*ics.VTimezone); ok {
+				id := ""
+				if p := tz.GetProperty(ics.ComponentProperty(ics.PropertyTzid)); p != nil {
+					id = p.Value
+				}
+				if !timezones[id] {
+					timezones[id] = true
+					merged.Components = append(merged.Components, c)
+				}
+				continue
+			}
+			component := environ.NewComponent(c)
+			if component == nil {
+				merged.Components = append(merged.Components, c)
+				continue
+			}
+			component.SetProperty(environ.PropertySource, sc.Name)
+
+			uid := component.Id()
+			owner, seen := owners[uid]
+			if uid == "" || !seen || owner == i {
+				owners[uid] = i
+				merged.Components = append(merged.Components, c)
+				continue
+			}
+			switch policy {
+			case model.SourceConflictKeepFirst:
+				continue
+			case model.SourceConflictKeepLast:
+				merged.Components = removeUID(merged.Components, uid)
+				owners[uid] = i
+			case model.SourceConflictFail:
+				return nil, fmt.Errorf("%w: %s (%s, %s)", ErrUIDConflict, uid, cals[owner].Name, sc.Name)
+			default:
+				component.SetProperty(ics.ComponentPropertyUniqueId, uid+"-"+sc.Name)
+			}
+			merged.Components = append(merged.Components, c)
+		}
+	}
+	return merged, nil
+}
+
+// stripSourceTags removes the source tags set by MergeSources
+func stripSourceTags(cal *ics.Calendar) {
+	for _, c := range cal.Components {
+		if component := environ.NewComponent(c); component != nil {
+			removeProperty(component.ComponentBase, environ.PropertySource)
+		}
+	}
+}
+
+// removeUID removes all events (tasks, journal entries) with the UID
+func removeUID(components []ics.Component, uid string) []ics.Component {
+	res := components[:0]
+	for _, c := range components {
+		if component := environ.NewComponent(c); component != nil && component.Id() == uid {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
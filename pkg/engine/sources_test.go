@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSources(t *testing.T) ([]*SourceCalendar, *model.Profile) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+source:
+  - source-name: lectures
+    type: http
+    url: https://example.com/lectures.ics
+  - source-name: events
+    type: html
+    url: https://example.com/events
+flows:
+  - if: 'Event.Source() == "events"'
+    then:
+      - do: actions/regex-replace
+        with:
+          match: '^'
+          replace: '[Event] '
+          in: [ "summary" ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cals := map[string]*ics.Calendar{"lectures": ics.NewCalendar(), "events": ics.NewCalendar()}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cals["lectures"].AddVEvent(newTestEvent("1", "Math", start))
+	cals["lectures"].AddVEvent(newTestEvent("2", "Physics", start))
+	cals["events"].AddVEvent(newTestEvent("2", "Party", start))
+	cals["events"].AddVEvent(newTestEvent("3", "Talk", start))
+
+	sources, err := FetchSources(profile.Source, func(src model.Source) (*ics.Calendar, error) {
+		return cals[model.SourceName(src)], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sources, profile
+}
+
+func summaries(cal *ics.Calendar) (res []string) {
+	for _, e := range cal.Events() {
+		res = append(res, e.Id()+":"+e.GetProperty(ics.ComponentPropertySummary).Value)
+	}
+	return
+}
+
+func TestMergeSources(t *testing.T) {
+	sources, profile := testSources(t)
+	cal, err := MergeSources(sources, profile.SourceConflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cal.Events()[0].GetProperty(environ.PropertySource); p == nil || p.Value != "lectures" {
+		t.Fatal("expected event to be tagged with its source")
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	expected := "1:Math 2:Physics 2-events:[Event] Party 3:[Event] Talk"
+	if got := strings.Join(summaries(cal), " "); got != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, got)
+	}
+	if strings.Contains(cal.Serialize(), environ.PropertySource) {
+		t.Fatal("expected source tags to be removed after processing")
+	}
+}
+
+func TestSingleSourceTagged(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  # the second event is not modified
+  - if: 'Event.Summary() == "Physics"'
+    then:
+      - return: true
+  - if: 'Event.Source() == "http"'
+    then:
+      - do: filters/filter-out
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := ics.NewCalendar()
+	src.AddVEvent(newTestEvent("1", "Math", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	src.AddVEvent(newTestEvent("2", "Physics", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)))
+	cal, err := MergeSources([]*SourceCalendar{{Name: "http", Calendar: src}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := Snapshot(cal)
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(summaries(cal), " "); got != "2:Physics" {
+		t.Fatalf("expected the event of the single source to be filtered out, got '%s'", got)
+	}
+	// the removed source tag is not a change
+	if diff := before.Diff(cal); len(diff.Changed) != 0 || len(diff.Removed) != 1 || diff.Unchanged != 1 {
+		t.Fatalf("expected one removed and one unchanged event, got %+v", diff)
+	}
+}
+
+func TestMergeSourcesConflictPolicies(t *testing.T) {
+	for policy, expected := range map[string]string{
+		model.SourceConflictKeepFirst: "1:Math 2:Physics 3:Talk",
+		model.SourceConflictKeepLast:  "1:Math 2:Party 3:Talk",
+	} {
+		sources, _ := testSources(t)
+		cal, err := MergeSources(sources, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(summaries(cal), " "); got != expected {
+			t.Fatalf("%s: expected '%s', got '%s'", policy, expected, got)
+		}
+	}
+	sources, _ := testSources(t)
+	if _, err := MergeSources(sources, model.SourceConflictFail); !errors.Is(err, ErrUIDConflict) {
+		t.Fatalf("expected ErrUIDConflict, got %v", err)
+	}
+	if _, err := MergeSources(sources, "merge"); !errors.Is(err, ErrUnknownSourceConflict) {
+		t.Fatalf("expected ErrUnknownSourceConflict, got %v", err)
+	}
+}
+
+func TestFetchSourcesDuplicateName(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+source:
+  - https://example.com/a.ics
+  - https://example.com/b.ics
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(model.Source) (*ics.Calendar, error) { return ics.NewCalendar(), nil }
+	if _, err = FetchSources(profile.Source, fetch); !errors.Is(err, ErrDuplicateSourceName) {
+		t.Fatalf("expected ErrDuplicateSourceName, got %v", err)
+	}
+	if err = Validate(profile); !errors.Is(err, ErrDuplicateSourceName) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestDedupeAcrossSources(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+after:
+  - do: calendar/dedupe
+    with:
+      by: time-summary
+      keep: last
+      union: [ attendee, categories ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	a, b := ics.NewCalendar(), ics.NewCalendar()
+	meeting := newTestEvent("a-1", "Team Meeting", start)
+	meeting.AddAttendee("alice@example.com")
+	meeting.SetProperty(ics.ComponentPropertyCategories, "Work,Team")
+	a.AddVEvent(meeting)
+	a.AddVEvent(newTestEvent("a-2", "Lunch", start))
+	duplicate := newTestEvent("b-1", "team-meeting ", start)
+	duplicate.AddAttendee("ALICE@example.com")
+	duplicate.AddAttendee("bob@example.com")
+	duplicate.SetProperty(ics.ComponentPropertyCategories, "team,Meeting")
+	b.AddVEvent(duplicate)
+
+	cal, err := MergeSources([]*SourceCalendar{{Name: "a", Calendar: a}, {Name: "b", Calendar: b}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &ContextFlow{Profile: profile, EnableDebug: true}
+	if err = ModifyCalendar(cp, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events()
+	if len(events) != 2 || events[0].Id() != "b-1" {
+		t.Fatalf("expected the last duplicate at the position of the first, got %v", summaries(cal))
+	}
+	if got := len(environ.NewComponent(events[0]).Attendees()); got != 2 {
+		t.Fatalf("expected 2 attendees, got %d", got)
+	}
+	if got := events[0].GetProperty(ics.ComponentPropertyCategories).Value; got != "team,Meeting,Work" {
+		t.Fatalf("expected merged categories, got '%s'", got)
+	}
+	if len(cp.Debugs) != 1 {
+		t.Fatalf("expected a dedupe report, got %v", cp.Debugs)
+	}
+	report, ok := cp.Debugs[0].(*actions.DedupeReport)
+	if !ok || report.Kept != "b-1" || len(report.Removed) != 1 || report.Removed[0] != "a-1" {
+		t.Fatalf("unexpected report: %+v", cp.Debugs[0])
+	}
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTest = errors.New("invalid test")
+
+// testTimeout is the maximum time to run the flows of a single test
+const testTimeout = 10 * time.Second
+
+// TestResult is the result of a single test of a profile
+type TestResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Diffs describe the differences between the expected and the actual result
+	Diffs []string `json:"diffs,omitempty"`
+}
+
+// testInput returns the input calendar of the test.
+// Input files are resolved relative to dir.
+func testInput(test *model.Test, dir string) (*ics.Calendar, error) {
+	input := test.Input
+	if test.InputFile != "" {
+		if input != "" {
+			return nil, fmt.Errorf("%w: input and input-file can't be used together", ErrInvalidTest)
+		}
+		path := test.InputFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		input = string(data)
+	}
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("%w: input or input-file required", ErrInvalidTest)
+	}
+	// inline inputs can omit the calendar
+	if !strings.HasPrefix(strings.TrimSpace(input), "BEGIN:VCALENDAR") {
+		input = "BEGIN:VCALENDAR\nVERSION:2.0\n" + strings.TrimSpace(input) + "\nEND:VCALENDAR\n"
+	}
+	// golang-ical requires CRLF line endings
+	input = strings.ReplaceAll(strings.ReplaceAll(input, "\r\n", "\n"), "\n", "\r\n")
+	return ics.ParseCalendar(strings.NewReader(input))
+}
+
+// RunTests runs all tests of the profile. Input files are resolved relative to dir.
+// An error is only returned if the profile can't be compiled.
+func RunTests(profile *model.Profile, dir string) ([]*TestResult, error) {
+	plan, err := CompileProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*TestResult, len(profile.Tests))
+	for i, test := range profile.Tests {
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("tests[%d]", i)
+		}
+		diffs := runTest(profile, plan, test, dir)
+		results[i] = &TestResult{Name: name, Passed: len(diffs) == 0, Diffs: diffs}
+	}
+	return results, nil
+}
+
+// runTest runs a single test and returns the differences to the expected result
+func runTest(profile *model.Profile, plan *Plan, test *model.Test, dir string) []string {
+	cal, err := testInput(test, dir)
+	if err != nil {
+		return []string{"input: " + err.Error()}
+	}
+	expect := test.Expect
+	if err = runTestFlows(profile, plan, test, cal); err != nil {
+		if expect.Error == "" {
+			return []string{"unexpected error: " + err.Error()}
+		}
+		if !strings.Contains(err.Error(), expect.Error) {
+			return []string{fmt.Sprintf("error: expected '%s', got '%s'", expect.Error, err.Error())}
+		}
+		return nil
+	}
+	if expect.Error != "" {
+		return []string{fmt.Sprintf("error: expected '%s', got none", expect.Error)}
+	}
+	return compareResult(cal, &expect)
+}
+
+// runTestFlows resolves the params of the test and runs the flows for the calendar
+func runTestFlows(profile *model.Profile, plan *Plan, test *model.Test, cal *ics.Calendar) error {
+	params, err := profile.Params.Resolve(func(name string) (string, bool) {
+		value, ok := test.Params[name]
+		return value, ok
+	})
+	if err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	cp := &ContextFlow{
+		Profile:    profile,
+		Context:    make(map[string]interface{}),
+		Params:     params,
+		RunContext: runCtx,
+	}
+	return ModifyCalendar(cp, plan, cal)
+}
+
+// compareResult compares the processed calendar with the expectation
+func compareResult(cal *ics.Calendar, expect *model.TestExpectation) (diffs []string) {
+	events := make(map[string]*environ.Component)
+	count := 0
+	for _, c := range cal.Components {
+		if component := environ.NewComponent(c); component != nil {
+			count++
+			if _, ok := events[component.Id()]; !ok {
+				events[component.Id()] = component
+			}
+		}
+	}
+	if expect.Count != nil && *expect.Count != count {
+		diffs = append(diffs, fmt.Sprintf("count: expected %d events, got %d", *expect.Count, count))
+	}
+	for _, uid := range expect.Kept {
+		if events[uid] == nil {
+			diffs = append(diffs, fmt.Sprintf("kept: event '%s' was removed", uid))
+		}
+	}
+	for _, uid := range expect.Removed {
+		if events[uid] != nil {
+			diffs = append(diffs, fmt.Sprintf("removed: event '%s' was kept", uid))
+		}
+	}
+
+	uids := make([]string, 0, len(expect.Events))
+	for uid := range expect.Events {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	for _, uid := range uids {
+		event := events[uid]
+		if event == nil {
+			diffs = append(diffs, fmt.Sprintf("events.%s: event not found", uid))
+			continue
+		}
+		properties := expect.Events[uid]
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			expected := properties[name]
+			prop := event.GetProperty(ics.ComponentProperty(strings.ToUpper(name)))
+			switch {
+			case expected == nil && prop != nil:
+				diffs = append(diffs, fmt.Sprintf("events.%s.%s: expected no value, got '%s'",
+					uid, name, ics.FromText(prop.Value)))
+			case expected != nil && prop == nil:
+				diffs = append(diffs, fmt.Sprintf("events.%s.%s: expected '%s', got no value", uid, name, *expected))
+			case expected != nil && ics.FromText(prop.Value) != *expected:
+				diffs = append(diffs, fmt.Sprintf("events.%s.%s: expected '%s', got '%s'",
+					uid, name, *expected, ics.FromText(prop.Value)))
+			}
+		}
+	}
+	return
+}
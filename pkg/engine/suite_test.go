@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"github.com/darmiel/ralf/pkg/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const suiteEvents = `
+BEGIN:VEVENT
+UID:math
+SUMMARY:TINF22B1 Math
+DTSTART:20230102T100000Z
+DTEND:20230102T110000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:physics
+SUMMARY:TINF22B2 Physics
+DTSTART:20230102T120000Z
+DTEND:20230102T130000Z
+LOCATION:Room 1
+END:VEVENT
+`
+
+func TestRunTests(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "input.ics"), []byte(suiteEvents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+params:
+  group:
+    type: string
+    default: B1
+    allowed: [ B1, B2 ]
+flows:
+  - if: 'not (Event.Summary() contains Params.group)'
+    then:
+      - do: filters/filter-out
+  - do: actions/regex-replace
+    with:
+      match: 'TINF\d+\w+ '
+      replace: ''
+      in: [ summary ]
+tests:
+  - name: keeps own group
+    input-file: input.ics
+    expect:
+      kept: [ math ]
+      removed: [ physics ]
+      count: 1
+      events:
+        math:
+          summary: Math
+          location: null
+  - name: other group
+    params:
+      group: B2
+    input: |` + strings.ReplaceAll(suiteEvents, "\n", "\n      ") + `
+    expect:
+      kept: [ physics ]
+      events:
+        physics:
+          SUMMARY: Physics
+          LOCATION: Room 2
+  - name: fails
+    input: |` + strings.ReplaceAll(suiteEvents, "\n", "\n      ") + `
+    expect:
+      removed: [ math ]
+  - name: unknown group
+    params:
+      group: X
+    input-file: input.ics
+    expect:
+      error: invalid parameter
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Validate(profile); err != nil {
+		t.Fatal(err)
+	}
+	results, err := RunTests(profile, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	if !results[0].Passed {
+		t.Fatalf("expected first test to pass, got %v", results[0].Diffs)
+	}
+	if results[1].Passed || len(results[1].Diffs) != 1 ||
+		results[1].Diffs[0] != "events.physics.LOCATION: expected 'Room 2', got 'Room 1'" {
+		t.Fatalf("expected location diff, got %v", results[1].Diffs)
+	}
+	if results[2].Passed || results[2].Diffs[0] != "removed: event 'math' was kept" {
+		t.Fatalf("expected removed diff, got %v", results[2].Diffs)
+	}
+	if !results[3].Passed {
+		t.Fatalf("expected error test to pass, got %v", results[3].Diffs)
+	}
+}
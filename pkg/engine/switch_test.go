@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwitch(t *testing.T) {
+	yamlProfile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - switch: 'Event.Summary()'
+    cases:
+      - case: Math
+        then:
+          - do: ctx/set
+            with:
+              course: M
+      - case: [ Physics, Chemistry ]
+        then:
+          - do: ctx/set
+            with:
+              course: S
+      - match: '^CS\d+$'
+        then:
+          - do: ctx/set
+            with:
+              course: CS
+    default:
+      - do: filters/filter-out
+  - do: actions/regex-replace
+    with:
+      match: '^'
+      replace: '* '
+      in: [ "summary" ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonProfile, err := model.ParseProfileFromJSON([]byte(`{"flows": [{
+		"switch": "Event.Summary()",
+		"cases": [
+			{"case": "Math", "then": []},
+			{"case": ["Physics", "Chemistry"], "then": []},
+			{"match": "^CS\\d+$", "then": []}
+		],
+		"default": [{"do": "filters/filter-out"}]
+	}, {"do": "actions/regex-replace", "with": {"match": "^", "replace": "* ", "in": ["summary"]}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []*model.Profile{yamlProfile, jsonProfile} {
+		plan, err := CompileProfile(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cal := ics.NewCalendar()
+		start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+		for _, summary := range []string{"Math", "Chemistry", "CS101", "CS", "Sports"} {
+			cal.AddVEvent(newTestEvent(summary, summary, start))
+		}
+		if err = ModifyCalendar(&ContextFlow{Profile: profile}, plan, cal); err != nil {
+			t.Fatal(err)
+		}
+		var summaries []string
+		for _, e := range cal.Events() {
+			summaries = append(summaries, e.GetProperty(ics.ComponentPropertySummary).Value)
+		}
+		if expected := "* Math,* Chemistry,* CS101"; strings.Join(summaries, ",") != expected {
+			t.Fatalf("expected %s, got %v", expected, summaries)
+		}
+	}
+}
+
+func TestSwitchInvalidCase(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - switch: 'Event.Summary()'
+    cases:
+      - then: []
+      - match: '('
+        then: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CompileProfile(profile)
+	if !errors.Is(err, ErrInvalidCase) || !strings.Contains(err.Error(), "flows[0].cases[1]: invalid pattern") {
+		t.Fatalf("expected invalid case errors, got %v", err)
+	}
+}
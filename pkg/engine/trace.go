@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"sort"
+	"strings"
+)
+
+const (
+	VerdictFilterIn  = "filter-in"
+	VerdictFilterOut = "filter-out"
+)
+
+const (
+	ScopeBefore = "before"
+	ScopeAfter  = "after"
+)
+
+// EventTrace records every flow which ran for a single event.
+// Traces of before and after flows have a Scope instead of a UID.
+type EventTrace struct {
+	UID     string       `json:"uid,omitempty"`
+	Scope   string       `json:"scope,omitempty"`
+	Steps   []*TraceStep `json:"steps"`
+	Verdict string       `json:"verdict,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// TraceStep is a single flow execution
+type TraceStep struct {
+	// Flow is the key identifier of the flow, e.g. `if` or `do`
+	Flow string `json:"flow"`
+
+	// Conditions contains all evaluated conditions of an `if` flow
+	Conditions []*ConditionTrace `json:"conditions,omitempty"`
+	// Result is the result of an `if` flow
+	Result *bool `json:"result,omitempty"`
+
+	// Action is the identifier of the action of a `do` flow
+	Action string `json:"action,omitempty"`
+	// With contains the arguments of the action
+	With map[string]interface{} `json:"with,omitempty"`
+	// Changes contains the properties which were changed by the action
+	Changes []*PropertyChange `json:"changes,omitempty"`
+	// Verdict is set if the action was a filter
+	Verdict string `json:"verdict,omitempty"`
+	// Ignored is true if the verdict was not applied because a final verdict was set before
+	Ignored bool `json:"ignored,omitempty"`
+
+	// Message is the message of a `debug` flow
+	Message interface{} `json:"message,omitempty"`
+	// Exit is true if the flow stopped the execution
+	Exit bool `json:"exit,omitempty"`
+	// Error is the error which occurred while running the flow
+	Error string `json:"error,omitempty"`
+
+	// Branch is the branch of a `switch` flow which ran, e.g. `cases[1]` or `default`
+	Branch string `json:"branch,omitempty"`
+	// Iterations is the number of iterations of a `foreach` flow
+	Iterations int `json:"iterations,omitempty"`
+	// Steps contains the child flows which ran
+	Steps []*TraceStep `json:"steps,omitempty"`
+}
+
+// ConditionTrace is a single evaluated condition
+type ConditionTrace struct {
+	Expression string `json:"expression"`
+	Result     bool   `json:"result"`
+}
+
+// PropertyChange contains the values of a property before and after a change
+type PropertyChange struct {
+	Property string   `json:"property"`
+	Before   []string `json:"before,omitempty"`
+	After    []string `json:"after,omitempty"`
+}
+
+func verdictOf(fact actions.ActionMessage) string {
+	if isFilteredOut(fact) {
+		return VerdictFilterOut
+	}
+	return VerdictFilterIn
+}
+
+// formatProperty returns the value of a property with its (sorted) parameters
+func formatProperty(prop ics.IANAProperty) string {
+	if len(prop.ICalParameters) == 0 {
+		return prop.Value
+	}
+	params := make([]string, 0, len(prop.ICalParameters))
+	for k, v := range prop.ICalParameters {
+		params = append(params, k+"="+strings.Join(v, ","))
+	}
+	sort.Strings(params)
+	return fmt.Sprintf("%s (%s)", prop.Value, strings.Join(params, ";"))
+}
+
+// snapshotProperties returns all properties and sub-components of a component grouped by name
+func snapshotProperties(base *ics.ComponentBase) map[string][]string {
+	res := make(map[string][]string)
+	for _, prop := range base.Properties {
+		// source tags are removed before the calendar is served
+		if prop.IANAToken == environ.PropertySource {
+			continue
+		}
+		res[prop.IANAToken] = append(res[prop.IANAToken], formatProperty(prop))
+	}
+	for _, c := range base.Components {
+		s, ok := c.(interface{ Serialize() string })
+		if !ok {
+			continue
+		}
+		str := s.Serialize()
+		name := strings.TrimPrefix(strings.SplitN(str, "\r\n", 2)[0], "BEGIN:")
+		res[name] = append(res[name], str)
+	}
+	return res
+}
+
+// diffProperties compares two snapshots and returns all changed properties sorted by name
+func diffProperties(before, after map[string][]string) []*PropertyChange {
+	var changes []*PropertyChange
+	for k, b := range before {
+		if a := after[k]; !equalStrings(a, b) {
+			changes = append(changes, &PropertyChange{Property: k, Before: b, After: a})
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes = append(changes, &PropertyChange{Property: k, After: a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Property < changes[j].Property
+	})
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
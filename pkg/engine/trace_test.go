@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"encoding/json"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+name: test
+flows:
+  - if: 'Event.Summary() == "Lecture"'
+    then:
+      - do: actions/regex-replace
+        with:
+          match: 'Lecture'
+          replace: 'Vorlesung'
+          in: [ "summary" ]
+      - return: true
+  - do: filters/filter-out
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Compile(profile.Flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	cal := ics.NewCalendar()
+	cal.AddVEvent(newTestEvent("a", "Lecture", start))
+	cal.AddVEvent(newTestEvent("b", "Exam", start))
+
+	cp := &ContextFlow{Profile: profile, EnableTrace: true}
+	if err = ModifyCalendar(cp, plan, cal); err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Traces) != 2 {
+		t.Fatalf("expected 2 traces, got %d", len(cp.Traces))
+	}
+
+	// events are processed from behind
+	exam, lecture := cp.Traces[0], cp.Traces[1]
+	if exam.UID != "b" || exam.Verdict != VerdictFilterOut || len(exam.Steps) != 2 {
+		t.Fatalf("unexpected trace for exam: %+v", exam)
+	}
+	if *exam.Steps[0].Result || exam.Steps[1].Verdict != VerdictFilterOut {
+		t.Fatal("expected exam condition to be false and filtered out")
+	}
+
+	if lecture.UID != "a" || lecture.Verdict != VerdictFilterIn || len(lecture.Steps) != 1 {
+		t.Fatalf("unexpected trace for lecture: %+v", lecture)
+	}
+	children := lecture.Steps[0].Steps
+	if len(children) != 2 || !children[1].Exit {
+		t.Fatal("expected regex-replace and return step")
+	}
+	changes := children[0].Changes
+	if len(changes) != 1 || changes[0].Property != "SUMMARY" || changes[0].After[0] != "Vorlesung" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	if _, err = json.Marshal(cp.Traces); err != nil {
+		t.Fatal(err)
+	}
+}
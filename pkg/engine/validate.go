@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/darmiel/ralf/pkg/model"
+	"sort"
+)
+
+// Validate checks a profile without running it.
+// Flows are compiled and the `with` values of all actions are checked against their schema.
+// All problems are returned at once, problems in flows are returned as FlowError.
+func Validate(profile *model.Profile) error {
+	var errs []error
+	fail := func(path string, err error) {
+		errs = append(errs, &FlowError{Path: path, Err: err})
+	}
+	if _, err := sourceNames(profile.Source); err != nil {
+		fail("source", err)
+	}
+	switch profile.SourceConflict {
+	case "", model.SourceConflictRename, model.SourceConflictKeepFirst,
+		model.SourceConflictKeepLast, model.SourceConflictFail:
+	default:
+		fail("source-conflict", fmt.Errorf("%w: %s", ErrUnknownSourceConflict, profile.SourceConflict))
+	}
+	if _, err := componentTypes(profile); err != nil {
+		fail("components", err)
+	}
+	switch profile.OnError {
+	case "", model.OnErrorFail, model.OnErrorSkipEvent, model.OnErrorKeepEvent:
+	default:
+		fail("on-error", fmt.Errorf("%w: %s", ErrUnknownErrorPolicy, profile.OnError))
+	}
+	if rec := profile.Recurrence; rec != nil {
+		switch rec.Mode {
+		case model.RecurrenceExpand, model.RecurrenceExDate:
+		default:
+			fail("recurrence.mode", fmt.Errorf("%w: %s", ErrUnknownRecurrenceMode, rec.Mode))
+		}
+	}
+
+	names := make([]string, 0, len(profile.Params))
+	for name := range profile.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := profile.Params[name]
+		if param == nil {
+			continue
+		}
+		switch param.Type {
+		case "", model.ParamTypeString, model.ParamTypeInt, model.ParamTypeFloat, model.ParamTypeBool:
+		default:
+			fail("params."+name+".type", fmt.Errorf("%w: %s", model.ErrUnknownParamType, param.Type))
+			continue
+		}
+		if param.Default == nil {
+			continue
+		}
+		if _, err := param.Parse(fmt.Sprint(param.Default)); err != nil {
+			fail("params."+name+".default", err)
+		}
+	}
+
+	for i, test := range profile.Tests {
+		if test == nil || (test.Input == "") == (test.InputFile == "") {
+			fail(fmt.Sprintf("tests[%d]", i), fmt.Errorf("%w: exactly one of input and input-file required", ErrInvalidTest))
+		}
+	}
+
+	if _, err := CompileProfileWith(profile, CompileOptions{Strict: true}); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"github.com/darmiel/ralf/pkg/model"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+on-error: ignore
+params:
+  limit:
+    type: int
+    default: many
+flows:
+  - do: actions/regex-replace
+    with:
+      match: 'a'
+      replac: 'b'
+  - if: 'true'
+    then:
+      - do: actions/add-alarm
+        with:
+          action: beep
+          trigger: 15
+      - do: actions/nope
+  - do: actions/remove-attendee
+    with:
+      $mail: 'Event.Nope()'
+after:
+  - do: calendar/limit
+    with:
+      max: '${Params.limit}'
+  - do: calendar/sort
+    with:
+      by: date
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Validate(profile)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"on-error: unknown on-error policy: ignore",
+		"params.limit.default: 'many' is not a valid int",
+		"flows[0]: unknown parameter 'replac'",
+		"flows[0]: requires exactly one of 'match' and 'replace' or 'map'",
+		"flows[1].then[0]: parameter 'action' must be one of audio, display, email, procedure, got 'beep'",
+		"flows[1].then[0]: parameter 'trigger' must be of type string, got int",
+		"flows[1].then[1]: invalid flow identifier: actions/nope",
+		"flows[2]: cannot compile '$mail'",
+		"after[1]: parameter 'by' must be one of start, end, summary, uid, got 'date'",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "after[0]") {
+		t.Fatalf("values referencing parameters should not be checked:\n%v", err)
+	}
+}
+
+func TestCompileStrict(t *testing.T) {
+	profile, err := model.ParseProfileFromYAML(strings.NewReader(`
+flows:
+  - do: actions/regex-replace
+    with:
+      match: 'a'
+      replace: 'b'
+      in: [ "summary" ]
+      stray: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stored profiles with unknown keys keep running
+	if _, err = CompileProfile(profile); err != nil {
+		t.Fatalf("expected profile to compile, got %v", err)
+	}
+	if _, err = CompileProfileWith(profile, CompileOptions{Strict: true}); err == nil ||
+		!strings.Contains(err.Error(), "flows[0]: unknown parameter 'stray'") {
+		t.Fatalf("expected unknown parameter, got %v", err)
+	}
+	if err = Validate(profile); err == nil {
+		t.Fatal("expected Validate to check the schema")
+	}
+}
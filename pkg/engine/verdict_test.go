@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+	"time"
+)
+
+const verdictFlows = `
+  - if: 'Event.Summary() == "Exam"'
+    then:
+      - return: keep
+  - if: 'Event.Summary() == "Holiday"'
+    then:
+      - return: drop
+  - if: 'Event.Summary() == "Lecture"'
+    then:
+      - do: filters/filter-in
+        with:
+          final: true
+  - do: filters/filter-out
+`
+
+func TestReturnVerdictAndFinalFilter(t *testing.T) {
+	yamlProfile, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nflows:" + verdictFlows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the return values must survive JSON and BSON
+	data, err := json.Marshal(map[string]interface{}{"flows": yamlProfile.Flows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonProfile, err := model.ParseProfileFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := bson.Marshal(bson.M{"flows": jsonProfile.Flows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bsonProfile model.Profile
+	if err = bson.Unmarshal(raw, &bsonProfile); err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []*model.Profile{yamlProfile, jsonProfile, &bsonProfile} {
+		plan, err := CompileProfile(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cal := ics.NewCalendar()
+		start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+		for _, summary := range []string{"Exam", "Holiday", "Lecture", "Sports"} {
+			cal.AddVEvent(newTestEvent(summary, summary, start))
+		}
+		cp := &ContextFlow{Profile: profile, EnableTrace: true}
+		if err = ModifyCalendar(cp, plan, cal); err != nil {
+			t.Fatal(err)
+		}
+		var uids []string
+		for _, e := range cal.Events() {
+			uids = append(uids, e.Id())
+		}
+		if expected := "Exam,Lecture"; strings.Join(uids, ",") != expected {
+			t.Fatalf("expected %s, got %v", expected, uids)
+		}
+		for _, trace := range cp.Traces {
+			if trace.UID != "Lecture" {
+				continue
+			}
+			last := trace.Steps[len(trace.Steps)-1]
+			if last.Verdict != VerdictFilterOut || !last.Ignored {
+				t.Fatalf("expected ignored filter-out after final verdict, got %+v", last)
+			}
+		}
+	}
+}
+
+func TestReturnInvalidVerdict(t *testing.T) {
+	_, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nflows:\n  - return: maybe\n"))
+	if !errors.Is(err, model.ErrInvalidReturn) {
+		t.Fatalf("expected ErrInvalidReturn, got %v", err)
+	}
+	profile, err := model.ParseProfileFromYAML(strings.NewReader("name: test\nbefore:\n  - return: drop\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CompileProfile(profile); !errors.Is(err, ErrNoCalendarVerdict) {
+		t.Fatalf("expected ErrNoCalendarVerdict, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package environ
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"strings"
+)
+
+// CalendarEnvironment is the environment for flows running once for the whole calendar (before, after)
+type CalendarEnvironment struct {
+	Functions
+	Calendar CtxCalendar
+	Context  util.NamedValues
+	// Params contains the values of the profile parameters
+	Params util.NamedValues
+}
+
+type CtxCalendar struct {
+	calendar *ics.Calendar
+}
+
+func NewCalendar(calendar *ics.Calendar) CtxCalendar {
+	return CtxCalendar{calendar: calendar}
+}
+
+// Property returns the value of any calendar property, e.g. X-WR-CALNAME
+func (c CtxCalendar) Property(name string) string {
+	return util.GetCalendarProperty(c.calendar, strings.ToUpper(name))
+}
+
+func (c CtxCalendar) Name() string {
+	return c.Property(string(ics.PropertyXWRCalName))
+}
+
+func (c CtxCalendar) Description() string {
+	return c.Property(string(ics.PropertyXWRCalDesc))
+}
+
+func (c CtxCalendar) Timezone() string {
+	return c.Property(string(ics.PropertyXWRTimezone))
+}
+
+// EventCount returns the number of events in the calendar
+func (c CtxCalendar) EventCount() int {
+	return len(c.calendar.Events())
+}
+
+func CreateCalendarEnvironment(calendar *ics.Calendar, sharedContext util.NamedValues) *CalendarEnvironment {
+	return &CalendarEnvironment{
+		Calendar: NewCalendar(calendar),
+		Context:  sharedContext,
+	}
+}
@@ -0,0 +1,100 @@
+package environ
+
+import (
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/internal/util"
+	"time"
+)
+
+var ErrPropertyNotFound = errors.New("property not found")
+
+// PropertySource contains the name of the source of a component if the profile has multiple sources
+const PropertySource = "X-RALF-SOURCE"
+
+// Component is a calendar component which can be processed by flows (VEVENT, VTODO or VJOURNAL).
+// Changes to the component are applied to the underlying calendar component.
+type Component struct {
+	*ics.ComponentBase
+	Type ics.ComponentType
+	// event is the wrapped event (nil for other components)
+	event *ics.VEvent
+}
+
+// NewComponent wraps a calendar component.
+// It returns nil if the component type cannot be processed by flows.
+func NewComponent(c ics.Component) *Component {
+	switch v := c.(type) {
+	case *ics.VEvent:
+		if v != nil {
+			return &Component{ComponentBase: &v.ComponentBase, Type: ics.ComponentVEvent, event: v}
+		}
+	case *ics.VTodo:
+		if v != nil {
+			return &Component{ComponentBase: &v.ComponentBase, Type: ics.ComponentVTodo}
+		}
+	case *ics.VJournal:
+		if v != nil {
+			return &Component{ComponentBase: &v.ComponentBase, Type: ics.ComponentVJournal}
+		}
+	}
+	return nil
+}
+
+// Event returns the wrapped event or nil if the component is not a VEVENT
+func (c *Component) Event() *ics.VEvent {
+	return c.event
+}
+
+// Id returns the UID of the component
+func (c *Component) Id() string {
+	if p := c.GetProperty(ics.ComponentPropertyUniqueId); p != nil {
+		return ics.FromText(p.Value)
+	}
+	return ""
+}
+
+// GetTime parses a DATE or DATE-TIME property, e.g. DTSTART or DUE
+func (c *Component) GetTime(property ics.ComponentProperty) (time.Time, error) {
+	prop := c.GetProperty(property)
+	if prop == nil {
+		return time.Time{}, ErrPropertyNotFound
+	}
+	// golang-ical only exposes time parsing for VEVENTs
+	tmp := *prop
+	tmp.IANAToken = string(ics.ComponentPropertyDtStart)
+	event := new(ics.VEvent)
+	event.Properties = []ics.IANAProperty{tmp}
+	return event.GetStartAt()
+}
+
+func (c *Component) Attendees() []*ics.Attendee {
+	return util.Attendees(c.ComponentBase)
+}
+
+func (c *Component) AddAttendee(mail string, props ...ics.PropertyParameter) {
+	c.AddProperty(ics.ComponentPropertyAttendee, "mailto:"+mail, props...)
+}
+
+func (c *Component) HasAttendee(mail string) bool {
+	return util.HasAttendee(c.ComponentBase, mail)
+}
+
+func (c *Component) RemoveAttendee(mail string) int {
+	return util.RemoveAttendee(c.ComponentBase, mail)
+}
+
+func (c *Component) Alarms() (r []*ics.VAlarm) {
+	for _, sub := range c.Components {
+		if alarm, ok := sub.(*ics.VAlarm); ok {
+			r = append(r, alarm)
+		}
+	}
+	return
+}
+
+func (c *Component) AddAlarm() *ics.VAlarm {
+	alarm := new(ics.VAlarm)
+	c.Components = append(c.Components, alarm)
+	return alarm
+}
@@ -9,54 +9,65 @@ import (
 	"time"
 )
 
+// Functions contains helper functions available in all expressions
+type Functions struct{}
+
 type ExprEnvironment struct {
-	Event   CtxEvent
-	Date    CtxTime
-	Start   CtxTime
-	End     CtxTime
-	Context util.NamedValues
+	Functions
+	Event     CtxEvent
+	Component CtxComponent
+	Date      CtxTime
+	Start     CtxTime
+	End       CtxTime
+	// Due and Completed are only set for components having a DUE or COMPLETED property (e.g. VTODO)
+	Due             CtxTime
+	Completed       CtxTime
+	PercentComplete int
+	Context         util.NamedValues
+	// Params contains the values of the profile parameters
+	Params util.NamedValues
 }
 
-func (e *ExprEnvironment) AORB(val bool, a, b string) string {
+func (Functions) AORB(val bool, a, b string) string {
 	if val {
 		return a
 	}
 	return b
 }
 
-func (e *ExprEnvironment) String(obj any) string {
+func (Functions) String(obj any) string {
 	return fmt.Sprintf("%+v", obj)
 }
 
-func (e *ExprEnvironment) Lower(inp string) string {
+func (Functions) Lower(inp string) string {
 	return strings.ToLower(inp)
 }
 
-func (e *ExprEnvironment) Upper(inp string) string {
+func (Functions) Upper(inp string) string {
 	return strings.ToUpper(inp)
 }
 
-func (e *ExprEnvironment) Trim(inp string) string {
+func (Functions) Trim(inp string) string {
 	return strings.TrimSpace(inp)
 }
 
-func (e *ExprEnvironment) Split(inp, sep string) []string {
+func (Functions) Split(inp, sep string) []string {
 	return strings.Split(inp, sep)
 }
 
-func (e *ExprEnvironment) Join(elems []string, sep string) string {
+func (Functions) Join(elems []string, sep string) string {
 	return strings.Join(elems, sep)
 }
 
-func (e *ExprEnvironment) Repeat(what string, times int) string {
+func (Functions) Repeat(what string, times int) string {
 	return strings.Repeat(what, times)
 }
 
-func (e *ExprEnvironment) Count(str, substr string) int {
+func (Functions) Count(str, substr string) int {
 	return strings.Count(str, substr)
 }
 
-func (e *ExprEnvironment) Replace(str, old, new string) string {
+func (Functions) Replace(str, old, new string) string {
 	return strings.ReplaceAll(str, old, new)
 }
 
@@ -65,7 +76,11 @@ type (
 		time *time.Time
 	}
 	CtxEvent struct {
-		event *ics.VEvent
+		event *Component
+	}
+	CtxComponent struct {
+		// Type is the type of the component, e.g. VEVENT or VTODO
+		Type string
 	}
 )
 
@@ -74,35 +89,44 @@ func NewTime(time time.Time) CtxTime {
 }
 
 func NewEvent(event ics.VEvent) CtxEvent {
-	return CtxEvent{event: &event}
+	return CtxEvent{event: NewComponent(&event)}
+}
+
+// IsSet returns false if the component doesn't have the property for this time
+func (c CtxTime) IsSet() bool {
+	return c.time != nil
+}
+
+func (c CtxTime) isWeekday(day time.Weekday) bool {
+	return c.time != nil && c.time.Weekday() == day
 }
 
 func (c CtxTime) IsMonday() bool {
-	return c.time.Weekday() == time.Monday
+	return c.isWeekday(time.Monday)
 }
 
 func (c CtxTime) IsTuesday() bool {
-	return c.time.Weekday() == time.Tuesday
+	return c.isWeekday(time.Tuesday)
 }
 
 func (c CtxTime) IsWednesday() bool {
-	return c.time.Weekday() == time.Wednesday
+	return c.isWeekday(time.Wednesday)
 }
 
 func (c CtxTime) IsThursday() bool {
-	return c.time.Weekday() == time.Thursday
+	return c.isWeekday(time.Thursday)
 }
 
 func (c CtxTime) IsFriday() bool {
-	return c.time.Weekday() == time.Friday
+	return c.isWeekday(time.Friday)
 }
 
 func (c CtxTime) IsSaturday() bool {
-	return c.time.Weekday() == time.Saturday
+	return c.isWeekday(time.Saturday)
 }
 
 func (c CtxTime) IsSunday() bool {
-	return c.time.Weekday() == time.Sunday
+	return c.isWeekday(time.Sunday)
 }
 
 func parseTime(time string) (hour, min int, ok bool) {
@@ -129,7 +153,7 @@ func parseTime(time string) (hour, min int, ok bool) {
 
 func (c CtxTime) IsAfter(time string) bool {
 	hr, min, ok := parseTime(time)
-	if !ok {
+	if !ok || c.time == nil {
 		return false
 	}
 	return c.time.Hour() >= hr && c.time.Minute() >= min
@@ -164,30 +188,90 @@ func (e CtxEvent) Location() string {
 	return e.getProp(ics.ComponentPropertyLocation)
 }
 
+// Source returns the name of the source the event was loaded from
+func (e CtxEvent) Source() string {
+	return e.getProp(PropertySource)
+}
+
 func (e CtxEvent) HasAttendee(mail string) bool {
-	return util.HasAttendee(e.event, mail)
+	return e.event.HasAttendee(mail)
 }
 
-func CreateExprEnvironmentFromEvent(event *ics.VEvent, sharedContext util.NamedValues) (*ExprEnvironment, error) {
-	start, err := event.GetStartAt()
-	if err != nil {
-		return nil, fmt.Errorf("get start at err: %v", err)
+// Attendees returns the mail addresses of all attendees
+func (e CtxEvent) Attendees() []string {
+	attendees := e.event.Attendees()
+	res := make([]string, len(attendees))
+	for i, a := range attendees {
+		res[i] = a.Email()
 	}
-	ctxStart := CtxTime{&start}
+	return res
+}
+
+func CreateExprEnvironmentFromEvent(event *ics.VEvent, sharedContext util.NamedValues) (*ExprEnvironment, error) {
+	return CreateExprEnvironment(NewComponent(event), sharedContext)
+}
 
-	end, err := event.GetEndAt()
+// optionalTime returns an unset CtxTime if the component doesn't have the property
+func optionalTime(component *Component, property ics.ComponentProperty) (CtxTime, error) {
+	t, err := component.GetTime(property)
+	if err == ErrPropertyNotFound {
+		return CtxTime{}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("get end at err: %v", err)
+		return CtxTime{}, fmt.Errorf("get %s err: %v", property, err)
 	}
-	ctxEnd := CtxTime{&end}
+	return CtxTime{&t}, nil
+}
 
-	return &ExprEnvironment{
+// CreateExprEnvironment creates the environment for a component.
+// VEVENTs require DTSTART and DTEND, for other components all times are optional.
+func CreateExprEnvironment(component *Component, sharedContext util.NamedValues) (*ExprEnvironment, error) {
+	env := &ExprEnvironment{
 		Event: CtxEvent{
-			event: event,
+			event: component,
+		},
+		Component: CtxComponent{
+			Type: string(component.Type),
 		},
-		Date:    ctxStart,
-		Start:   ctxStart,
-		End:     ctxEnd,
 		Context: sharedContext,
-	}, nil
+	}
+
+	var err error
+	if component.Type == ics.ComponentVEvent {
+		start, err := component.GetTime(ics.ComponentPropertyDtStart)
+		if err != nil {
+			return nil, fmt.Errorf("get start at err: %v", err)
+		}
+		env.Start = CtxTime{&start}
+
+		end, err := component.GetTime(ics.ComponentPropertyDtEnd)
+		if err != nil {
+			return nil, fmt.Errorf("get end at err: %v", err)
+		}
+		env.End = CtxTime{&end}
+	} else if env.Start, err = optionalTime(component, ics.ComponentPropertyDtStart); err != nil {
+		return nil, err
+	}
+
+	if env.Due, err = optionalTime(component, ics.ComponentProperty(ics.PropertyDue)); err != nil {
+		return nil, err
+	}
+	if env.Completed, err = optionalTime(component, ics.ComponentProperty(ics.PropertyCompleted)); err != nil {
+		return nil, err
+	}
+	if p := component.GetProperty(ics.ComponentProperty(ics.PropertyPercentComplete)); p != nil {
+		if env.PercentComplete, err = strconv.Atoi(p.Value); err != nil {
+			return nil, fmt.Errorf("invalid PERCENT-COMPLETE: %v", err)
+		}
+	}
+
+	// tasks end when they are due
+	if !env.End.IsSet() {
+		env.End = env.Due
+	}
+	env.Date = env.Start
+	if !env.Date.IsSet() {
+		env.Date = env.Due
+	}
+	return env, nil
 }
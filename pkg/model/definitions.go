@@ -0,0 +1,120 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+var ErrRecursiveDefinition = errors.New("recursive definition")
+
+// Definitions are named flow blocks which can be run with a UseFlow
+type Definitions map[string]Flows
+
+func (d *Definitions) UnmarshalYAML(value *yaml.Node) error {
+	var m map[string]Flows
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	*d = m
+	return d.checkRecursion()
+}
+
+func (d *Definitions) UnmarshalJSON(data []byte) error {
+	var m map[string]Flows
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*d = m
+	return d.checkRecursion()
+}
+
+func (d *Definitions) UnmarshalBSON(data []byte) error {
+	var raw bson.Raw
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	elements, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]Flows, len(elements))
+	for _, e := range elements {
+		var flows Flows
+		if err = flows.UnmarshalBSON(e.Value().Value); err != nil {
+			return err
+		}
+		m[e.Key()] = flows
+	}
+	*d = m
+	return d.checkRecursion()
+}
+
+// checkRecursion returns an error if a definition uses itself (directly or through other definitions)
+func (d *Definitions) checkRecursion() error {
+	names := make([]string, 0, len(*d))
+	for name := range *d {
+		names = append(names, name)
+	}
+	// sort names to always report the same cycle
+	sort.Strings(names)
+	done := make(map[string]bool)
+	for _, name := range names {
+		if err := d.visit(name, nil, done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Definitions) visit(name string, stack []string, done map[string]bool) error {
+	for i, s := range stack {
+		if s == name {
+			return fmt.Errorf("%w: %s", ErrRecursiveDefinition, strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+	if done[name] {
+		return nil
+	}
+	flows, ok := (*d)[name]
+	if !ok {
+		// unknown definitions are reported when compiling
+		return nil
+	}
+	stack = append(stack, name)
+	for _, use := range usedDefinitions(flows) {
+		if err := d.visit(use, stack, done); err != nil {
+			return err
+		}
+	}
+	done[name] = true
+	return nil
+}
+
+// usedDefinitions returns the names of all definitions used in flows (including child flows)
+func usedDefinitions(flows Flows) (res []string) {
+	for _, flow := range flows {
+		switch f := flow.(type) {
+		case *UseFlow:
+			res = append(res, f.Use)
+		case *ConditionFlow:
+			res = append(res, usedDefinitions(f.Then)...)
+			res = append(res, usedDefinitions(f.Else)...)
+		case *ForeachFlow:
+			res = append(res, usedDefinitions(f.Flows)...)
+		case *SwitchFlow:
+			for _, c := range f.Cases {
+				res = append(res, usedDefinitions(c.Then)...)
+			}
+			res = append(res, usedDefinitions(f.Default)...)
+		case *TryFlow:
+			res = append(res, usedDefinitions(f.Try)...)
+			res = append(res, usedDefinitions(f.Catch)...)
+		}
+	}
+	return
+}
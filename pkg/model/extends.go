@@ -0,0 +1,148 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrRecursiveExtends = errors.New("recursive extends")
+	ErrProfileNotFound  = errors.New("profile not found")
+)
+
+// ProfileLoader loads the profile referenced by `extends`.
+// from is the id of the extending profile (empty for the profile which is resolved).
+// The returned id identifies the loaded profile and is used to detect cycles.
+type ProfileLoader func(ref, from string) (profile *Profile, id string, err error)
+
+// FileLoader loads profiles from YAML files. Relative paths are resolved relative to the extending profile.
+func FileLoader(ref, from string) (*Profile, string, error) {
+	path := ref
+	if !filepath.IsAbs(path) && from != "" {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", fmt.Errorf("%w: %s", ErrProfileNotFound, ref)
+		}
+		return nil, "", err
+	}
+	defer f.Close()
+	profile, err := ParseProfileFromYAML(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", ref, err)
+	}
+	return profile, path, nil
+}
+
+var storedProfileID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// DirLoader loads stored profiles by their ID (<dir>/<id>.yaml).
+// IDs can't contain paths, so only profiles of the directory can be loaded.
+func DirLoader(dir string) ProfileLoader {
+	return func(ref, _ string) (*Profile, string, error) {
+		if !storedProfileID.MatchString(ref) {
+			return nil, "", fmt.Errorf("%w: invalid profile id '%s'", ErrProfileNotFound, ref)
+		}
+		f, err := os.Open(filepath.Join(dir, ref+".yaml"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, "", fmt.Errorf("%w: %s", ErrProfileNotFound, ref)
+			}
+			return nil, "", err
+		}
+		defer f.Close()
+		profile, err := ParseProfileFromYAML(f)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", ref, err)
+		}
+		return profile, ref, nil
+	}
+}
+
+// ResolveExtends merges the profiles referenced by `extends` into the profile.
+// id identifies the profile itself for the loader and cycle detection (can be empty).
+//
+// Name, source, source conflict, cache duration, recurrence, components and on-error of the profile override the base profile if set.
+// The flows (and before / after flows) of the base profile run before the flows of the profile.
+// Definitions and params are merged, those of the profile override the base profile.
+func (p *Profile) ResolveExtends(id string, load ProfileLoader) error {
+	var chain []string
+	if id != "" {
+		chain = append(chain, id)
+	}
+	from := id
+	for p.Extends != "" {
+		base, baseID, err := load(p.Extends, from)
+		if err != nil {
+			return err
+		}
+		from = baseID
+		for _, seen := range chain {
+			if seen == baseID {
+				return fmt.Errorf("%w: %s -> %s", ErrRecursiveExtends, strings.Join(chain, " -> "), baseID)
+			}
+		}
+		chain = append(chain, baseID)
+		p.Extends = base.Extends
+		p.merge(base)
+	}
+	return p.Definitions.checkRecursion()
+}
+
+// merge merges the base profile into the profile
+func (p *Profile) merge(base *Profile) {
+	if p.Name == "" {
+		p.Name = base.Name
+	}
+	if len(p.Source) == 0 {
+		p.Source = base.Source
+	}
+	if p.SourceConflict == "" {
+		p.SourceConflict = base.SourceConflict
+	}
+	if p.CacheDuration == 0 {
+		p.CacheDuration = base.CacheDuration
+	}
+	if p.Recurrence == nil {
+		p.Recurrence = base.Recurrence
+	}
+	if len(p.Components) == 0 {
+		p.Components = base.Components
+	}
+	if p.OnError == "" {
+		p.OnError = base.OnError
+	}
+	p.Flows = append(append(Flows{}, base.Flows...), p.Flows...)
+	p.Before = append(append(Flows{}, base.Before...), p.Before...)
+	p.After = append(append(Flows{}, base.After...), p.After...)
+	if len(base.Definitions) > 0 {
+		merged := make(Definitions, len(base.Definitions)+len(p.Definitions))
+		for name, flows := range base.Definitions {
+			merged[name] = flows
+		}
+		for name, flows := range p.Definitions {
+			merged[name] = flows
+		}
+		p.Definitions = merged
+	}
+	if len(base.Params) > 0 {
+		merged := make(Params, len(base.Params)+len(p.Params))
+		for name, param := range base.Params {
+			merged[name] = param
+		}
+		for name, param := range p.Params {
+			merged[name] = param
+		}
+		p.Params = merged
+	}
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeProfiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolveExtends(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base.yaml": `
+name: Base
+source: https://example.com/calendar.ics
+cache-duration: 10m
+flows:
+  - do: actions/clear-alarms
+definitions:
+  cleanup:
+    - do: actions/clear-attendees
+  drop:
+    - do: filters/filter-out
+params:
+  group:
+    type: string
+    default: A
+`,
+		"group.yaml": `
+extends: base.yaml
+name: Group
+flows:
+  - use: cleanup
+definitions:
+  drop:
+    - return: true
+`,
+	})
+	profile, err := ParseProfileFromYAML(strings.NewReader(`
+extends: group.yaml
+cache-duration: 5m
+flows:
+  - if: 'Event.Summary() == "Math"'
+    then:
+      - use: drop
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = profile.ResolveExtends(filepath.Join(dir, "derived.yaml"), FileLoader); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "Group" || len(profile.Source) != 1 || time.Duration(profile.CacheDuration) != 5*time.Minute {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+	if len(profile.Flows) != 3 {
+		t.Fatalf("expected 3 flows, got %d", len(profile.Flows))
+	}
+	if _, ok := profile.Flows[0].(*ActionFlow); !ok {
+		t.Fatalf("expected flows of the base profile first, got %T", profile.Flows[0])
+	}
+	if _, ok := profile.Flows[2].(*ConditionFlow); !ok {
+		t.Fatalf("expected own flows last, got %T", profile.Flows[2])
+	}
+	if _, ok := profile.Definitions["drop"][0].(*ReturnFlow); !ok {
+		t.Fatal("expected definition to be overridden")
+	}
+	if len(profile.Definitions) != 2 || len(profile.Params) != 1 {
+		t.Fatalf("expected merged definitions and params, got %v / %v", profile.Definitions, profile.Params)
+	}
+	if profile.Extends != "" {
+		t.Fatal("expected extends to be resolved")
+	}
+}
+
+func TestResolveExtendsRecursive(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"a.yaml": "extends: b.yaml\n",
+		"b.yaml": "extends: a.yaml\n",
+	})
+	profile := &Profile{Extends: "a.yaml"}
+	if err := profile.ResolveExtends(filepath.Join(dir, "root.yaml"), FileLoader); !errors.Is(err, ErrRecursiveExtends) {
+		t.Fatalf("expected ErrRecursiveExtends, got %v", err)
+	}
+}
+
+func TestDirLoader(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base.yaml": "name: Base\n",
+		"self.yaml": "extends: self\n",
+	})
+	load := DirLoader(dir)
+	profile := &Profile{Extends: "base"}
+	if err := profile.ResolveExtends("", load); err != nil || profile.Name != "Base" {
+		t.Fatalf("expected stored profile to be merged, got %v (%s)", err, profile.Name)
+	}
+	if err := (&Profile{Extends: "../base"}).ResolveExtends("", load); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound for path, got %v", err)
+	}
+	if err := (&Profile{Extends: "missing"}).ResolveExtends("", load); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound, got %v", err)
+	}
+	if err := (&Profile{Extends: "self"}).ResolveExtends("", load); !errors.Is(err, ErrRecursiveExtends) {
+		t.Fatalf("expected ErrRecursiveExtends, got %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package model
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"gopkg.in/yaml.v3"
 )
 
@@ -27,73 +30,255 @@ func (a *ActionFlow) KeyIdentifier() string {
 
 ///
 
-type Conditions []string
+// condition groups
+const (
+	ConditionAll = "all"
+	ConditionAny = "any"
+	ConditionNot = "not"
+)
+
+var ErrInvalidCondition = errors.New("invalid condition")
+
+// Condition is either an expression or a group of conditions (all, any or not) which can be nested
+type Condition struct {
+	Expr string
+	All  Conditions
+	Any  Conditions
+	Not  *Condition
+}
 
-func (c *Conditions) MarshalYAML() (interface{}, error) {
-	if len(*c) == 1 {
-		return (*c)[0], nil
+// Group returns the group of the condition (ConditionAll, ConditionAny, ConditionNot) or an empty string for expressions
+func (c *Condition) Group() string {
+	switch {
+	case c.Not != nil:
+		return ConditionNot
+	case c.All != nil:
+		return ConditionAll
+	case c.Any != nil:
+		return ConditionAny
 	}
-	return c, nil
+	return ""
 }
 
-func (c *Conditions) UnmarshalYAML(value *yaml.Node) error {
-	if value.Tag == "!!str" {
-		var single string
-		if err := value.Decode(&single); err != nil {
-			return err
+// value returns the expression or the group as a map
+func (c *Condition) value() interface{} {
+	switch c.Group() {
+	case ConditionNot:
+		return map[string]interface{}{ConditionNot: c.Not.value()}
+	case ConditionAll:
+		return map[string]interface{}{ConditionAll: c.All.list()}
+	case ConditionAny:
+		return map[string]interface{}{ConditionAny: c.Any.list()}
+	}
+	return c.Expr
+}
+
+// parseCondition parses an expression or a group from a decoded YAML / JSON value
+func parseCondition(v interface{}) (*Condition, error) {
+	switch value := v.(type) {
+	case string:
+		return &Condition{Expr: value}, nil
+	case map[string]interface{}:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("%w: a group requires exactly one of all, any or not", ErrInvalidCondition)
 		}
-		*c = []string{single}
-	} else {
-		var multi []string
-		if err := value.Decode(&multi); err != nil {
-			return err
+		for k, inner := range value {
+			switch k {
+			case ConditionNot:
+				not, err := parseCondition(inner)
+				if err != nil {
+					return nil, err
+				}
+				return &Condition{Not: not}, nil
+			case ConditionAll, ConditionAny:
+				list, ok := inner.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%w: %s requires a list", ErrInvalidCondition, k)
+				}
+				conditions, err := parseConditions(list)
+				if err != nil {
+					return nil, err
+				}
+				// groups are never nil to tell them apart from expressions
+				if conditions == nil {
+					conditions = Conditions{}
+				}
+				if k == ConditionAll {
+					return &Condition{All: conditions}, nil
+				}
+				return &Condition{Any: conditions}, nil
+			}
+			return nil, fmt.Errorf("%w: unknown group '%s'", ErrInvalidCondition, k)
 		}
-		*c = multi
 	}
-	return nil
+	return nil, fmt.Errorf("%w: expected an expression or a group, got %T", ErrInvalidCondition, v)
 }
 
-func (c *Conditions) MarshalJSON() ([]byte, error) {
-	if len(*c) == 1 {
-		return json.Marshal((*c)[0])
+// Conditions are combined using the operator of the flow (or the group they are in)
+type Conditions []*Condition
+
+func parseConditions(list []interface{}) (res Conditions, err error) {
+	for _, v := range list {
+		c, err := parseCondition(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
 	}
-	return json.Marshal([]string(*c))
+	return
 }
 
-func (c *Conditions) UnmarshalJSON(val []byte) error {
-	if bytes.HasPrefix(val, []byte("\"")) {
-		var single string
-		if err := json.Unmarshal(val, &single); err != nil {
-			return err
-		}
-		*c = []string{single}
-	} else {
-		var multi []string
-		if err := json.Unmarshal(val, &multi); err != nil {
+func (c Conditions) list() []interface{} {
+	res := make([]interface{}, len(c))
+	for i, cond := range c {
+		res[i] = cond.value()
+	}
+	return res
+}
+
+// value returns a single condition without a list
+func (c Conditions) value() interface{} {
+	if len(c) == 1 {
+		return c[0].value()
+	}
+	return c.list()
+}
+
+// set parses a single condition or a list of conditions
+func (c *Conditions) set(v interface{}) error {
+	if list, ok := v.([]interface{}); ok {
+		res, err := parseConditions(list)
+		if err != nil {
 			return err
 		}
-		*c = multi
+		*c = res
+		return nil
+	}
+	single, err := parseCondition(v)
+	if err != nil {
+		return err
 	}
+	*c = Conditions{single}
 	return nil
 }
 
-// ConditionFlow represents a condition
+func (c Conditions) MarshalYAML() (interface{}, error) {
+	return c.value(), nil
+}
+
+func (c *Conditions) UnmarshalYAML(value *yaml.Node) error {
+	var v interface{}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	return c.set(v)
+}
+
+func (c Conditions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.value())
+}
+
+func (c *Conditions) UnmarshalJSON(val []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(val, &v); err != nil {
+		return err
+	}
+	return c.set(v)
+}
+
+func (c Conditions) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(c.value())
+}
+
+// ConditionFlow runs Then if the conditions are true, otherwise Else.
+// An empty If is false. Unless is the negation of If, only one of them can be used.
 type ConditionFlow struct {
+	// Condition is always serialized (even if empty) because flows are detected by their keys
 	Condition Conditions `yaml:"if" json:"if" bson:"if"`
+	Unless    Conditions `yaml:"unless,omitempty" json:"unless,omitempty" bson:"unless,omitempty"`
 	Operator  string     `yaml:"op" json:"op" bson:"op"`
 	Then      Flows      `yaml:"then" json:"then" bson:"then"`
 	Else      Flows      `yaml:"else" json:"else" bson:"else"`
 }
 
 func (c *ConditionFlow) KeyIdentifier() string {
+	if len(c.Condition) == 0 && len(c.Unless) > 0 {
+		return "unless"
+	}
 	return "if"
 }
 
 ///
 
-// ReturnFlow stops the current execution immediately
+// verdicts of a return flow
+const (
+	ReturnKeep = "keep"
+	ReturnDrop = "drop"
+)
+
+var ErrInvalidReturn = errors.New("return must be a boolean, 'keep' or 'drop'")
+
+// ReturnValue is either a boolean or a verdict (`keep` or `drop`) which is set before exiting
+type ReturnValue struct {
+	Exit bool
+	// Verdict is ReturnKeep, ReturnDrop or empty
+	Verdict string
+}
+
+// value returns the boolean or the verdict
+func (r ReturnValue) value() interface{} {
+	if r.Verdict != "" {
+		return r.Verdict
+	}
+	return r.Exit
+}
+
+func (r *ReturnValue) set(v interface{}) error {
+	switch value := v.(type) {
+	case bool:
+		*r = ReturnValue{Exit: value}
+		return nil
+	case string:
+		if value == ReturnKeep || value == ReturnDrop {
+			*r = ReturnValue{Exit: true, Verdict: value}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, got '%v'", ErrInvalidReturn, v)
+}
+
+func (r ReturnValue) MarshalYAML() (interface{}, error) {
+	return r.value(), nil
+}
+
+func (r *ReturnValue) UnmarshalYAML(value *yaml.Node) error {
+	var v interface{}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	return r.set(v)
+}
+
+func (r ReturnValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.value())
+}
+
+func (r *ReturnValue) UnmarshalJSON(val []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(val, &v); err != nil {
+		return err
+	}
+	return r.set(v)
+}
+
+func (r ReturnValue) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(r.value())
+}
+
+// ReturnFlow stops the current execution immediately.
+// `return: keep` and `return: drop` also set the verdict of the event.
 type ReturnFlow struct {
-	Return bool `yaml:"return" json:"return" bson:"return"`
+	Return ReturnValue `yaml:"return" json:"return" bson:"return"`
 }
 
 func (r *ReturnFlow) KeyIdentifier() string {
@@ -110,3 +295,73 @@ type DebugFlow struct {
 func (d *DebugFlow) KeyIdentifier() string {
 	return "debug"
 }
+
+///
+
+// UseFlow runs the flows of a named definition of the profile.
+// The values in With are set in the shared context before the flows run.
+type UseFlow struct {
+	Use  string                 `yaml:"use" json:"use" bson:"use"`
+	With map[string]interface{} `yaml:"with" json:"with" bson:"with"`
+}
+
+func (u *UseFlow) KeyIdentifier() string {
+	return "use"
+}
+
+///
+
+// ForeachFlow runs Flows once for every element of the result of the Foreach expression.
+// The current element is set in the shared context under the name As (defaults to "item").
+type ForeachFlow struct {
+	Foreach string `yaml:"foreach" json:"foreach" bson:"foreach"`
+	As      string `yaml:"as" json:"as" bson:"as"`
+	Flows   Flows  `yaml:"flows" json:"flows" bson:"flows"`
+}
+
+func (f *ForeachFlow) KeyIdentifier() string {
+	return "foreach"
+}
+
+// Name returns the name of the current element in the shared context
+func (f *ForeachFlow) Name() string {
+	if f.As == "" {
+		return "item"
+	}
+	return f.As
+}
+
+///
+
+// SwitchCase is a branch of a SwitchFlow.
+// Case can be a single value or a list of values, Match is a regular expression.
+type SwitchCase struct {
+	Case  interface{} `yaml:"case,omitempty" json:"case,omitempty" bson:"case,omitempty"`
+	Match string      `yaml:"match,omitempty" json:"match,omitempty" bson:"match,omitempty"`
+	Then  Flows       `yaml:"then" json:"then" bson:"then"`
+}
+
+// SwitchFlow evaluates an expression once and runs the first case which matches the result.
+// Default runs if no case matches.
+type SwitchFlow struct {
+	Switch  string        `yaml:"switch" json:"switch" bson:"switch"`
+	Cases   []*SwitchCase `yaml:"cases" json:"cases" bson:"cases"`
+	Default Flows         `yaml:"default" json:"default" bson:"default"`
+}
+
+func (s *SwitchFlow) KeyIdentifier() string {
+	return "switch"
+}
+
+///
+
+// TryFlow runs the Try flows and the Catch flows if an error occurred.
+// The error message is set in the shared context as "error".
+type TryFlow struct {
+	Try   Flows `yaml:"try" json:"try" bson:"try"`
+	Catch Flows `yaml:"catch" json:"catch" bson:"catch"`
+}
+
+func (t *TryFlow) KeyIdentifier() string {
+	return "try"
+}
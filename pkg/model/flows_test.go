@@ -0,0 +1,103 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+const nestedConditions = `
+flows:
+  - if:
+      all:
+        - 'Event.Summary() contains "Lecture"'
+        - any:
+            - 'Date.isMonday()'
+            - not: 'Date.isFriday()'
+    then: []
+  - unless: [ 'a', 'b' ]
+    op: or
+    then: []
+  - if: 'single'
+    then: []
+  - if: []
+    then: []
+`
+
+func TestConditionsRoundTrip(t *testing.T) {
+	yamlProfile, err := ParseProfileFromYAML(strings.NewReader(nestedConditions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(source string, flows Flows) {
+		if len(flows) != 4 {
+			t.Fatalf("%s: expected 4 flows, got %d", source, len(flows))
+		}
+		nested := flows[0].(*ConditionFlow).Condition
+		if len(nested) != 1 || nested[0].Group() != ConditionAll || len(nested[0].All) != 2 {
+			t.Fatalf("%s: expected all group with 2 conditions, got %+v", source, nested)
+		}
+		anyGroup := nested[0].All[1]
+		if anyGroup.Group() != ConditionAny || anyGroup.Any[1].Not.Expr != "Date.isFriday()" {
+			t.Fatalf("%s: expected nested any and not groups, got %+v", source, anyGroup)
+		}
+		unless := flows[1].(*ConditionFlow)
+		if unless.KeyIdentifier() != "unless" || len(unless.Unless) != 2 || unless.Unless[1].Expr != "b" {
+			t.Fatalf("%s: expected unless with 2 conditions, got %+v", source, unless)
+		}
+		if single := flows[2].(*ConditionFlow).Condition; len(single) != 1 || single[0].Expr != "single" {
+			t.Fatalf("%s: expected single condition, got %+v", source, single)
+		}
+		if empty, ok := flows[3].(*ConditionFlow); !ok || len(empty.Condition) != 0 || empty.KeyIdentifier() != "if" {
+			t.Fatalf("%s: expected if flow without conditions, got %+v", source, flows[3])
+		}
+	}
+	check("yaml", yamlProfile.Flows)
+
+	data, err := yaml.Marshal(map[string]interface{}{"flows": yamlProfile.Flows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := ParseProfileFromYAML(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("yaml (marshaled)", reparsed.Flows)
+
+	data, err = json.Marshal(map[string]interface{}{"flows": yamlProfile.Flows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonProfile, err := ParseProfileFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("json", jsonProfile.Flows)
+
+	raw, err := bson.Marshal(bson.M{"flows": jsonProfile.Flows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bsonProfile Profile
+	if err = bson.Unmarshal(raw, &bsonProfile); err != nil {
+		t.Fatal(err)
+	}
+	check("bson", bsonProfile.Flows)
+}
+
+func TestInvalidConditions(t *testing.T) {
+	for _, cond := range []string{
+		"{ all: 'a' }",
+		"{ some: [ 'a' ] }",
+		"{ all: [ 'a' ], any: [ 'b' ] }",
+		"[ 'a', 1 ]",
+	} {
+		_, err := ParseProfileFromYAML(strings.NewReader("flows:\n  - if: " + cond + "\n    then: []\n"))
+		if !errors.Is(err, ErrInvalidCondition) {
+			t.Fatalf("expected ErrInvalidCondition for %s, got %v", cond, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	ParamTypeString = "string"
+	ParamTypeInt    = "int"
+	ParamTypeFloat  = "float"
+	ParamTypeBool   = "bool"
+)
+
+var (
+	ErrMissingParam     = errors.New("missing parameter")
+	ErrInvalidParam     = errors.New("invalid parameter")
+	ErrUnknownParamType = errors.New("unknown parameter type")
+)
+
+// Param declares a parameter of a profile which is supplied when the profile is processed
+type Param struct {
+	// Type is either "string", "int", "float" or "bool" (defaults to "string")
+	Type string `yaml:"type,omitempty" json:"type,omitempty" bson:"type,omitempty"`
+	// Default is used if no value is supplied. Parameters without a default are required.
+	Default interface{} `yaml:"default,omitempty" json:"default,omitempty" bson:"default,omitempty"`
+	// Allowed restricts the values of the parameter (optional)
+	Allowed []interface{} `yaml:"allowed,omitempty" json:"allowed,omitempty" bson:"allowed,omitempty"`
+	// Description is shown to users of the profile
+	Description string `yaml:"description,omitempty" json:"description,omitempty" bson:"description,omitempty"`
+}
+
+// Parse converts a supplied value to the type of the parameter and checks if it's allowed
+func (p *Param) Parse(value string) (interface{}, error) {
+	var (
+		res interface{}
+		err error
+	)
+	switch p.Type {
+	case "", ParamTypeString:
+		res = value
+	case ParamTypeInt:
+		res, err = strconv.Atoi(value)
+	case ParamTypeFloat:
+		res, err = strconv.ParseFloat(value, 64)
+	case ParamTypeBool:
+		res, err = strconv.ParseBool(value)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownParamType, p.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid %s", value, p.Type)
+	}
+	if len(p.Allowed) == 0 {
+		return res, nil
+	}
+	// YAML and JSON decode numbers differently, so allowed values are compared by their string representation
+	for _, a := range p.Allowed {
+		if fmt.Sprint(a) == fmt.Sprint(res) {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' is not allowed, expected one of %v", value, p.Allowed)
+}
+
+// Params are the declared parameters of a profile by name
+type Params map[string]*Param
+
+// Resolve returns the values of all declared parameters.
+// lookup returns the supplied value of a parameter, the default value is used if no value was supplied.
+func (p Params) Resolve(lookup func(name string) (string, bool)) (map[string]interface{}, error) {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	// sort names to always report the same error first
+	sort.Strings(names)
+
+	res := make(map[string]interface{}, len(p))
+	var errs []error
+	for _, name := range names {
+		param := p[name]
+		if param == nil {
+			param = new(Param)
+		}
+		value, ok := lookup(name)
+		if !ok {
+			if param.Default == nil {
+				errs = append(errs, fmt.Errorf("%w: %s", ErrMissingParam, name))
+				continue
+			}
+			value = fmt.Sprint(param.Default)
+		}
+		v, err := param.Parse(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w %s: %v", ErrInvalidParam, name, err))
+			continue
+		}
+		res[name] = v
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return res, nil
+}
@@ -24,10 +24,15 @@ func convertFun[T Flow]() func([]byte) (Flow, error) {
 
 var bsonKeys = map[string]bsonConverterFun{
 	// condition flow
-	"if":     convertFun[*ConditionFlow](),
-	"do":     convertFun[*ActionFlow](),
-	"debug":  convertFun[*DebugFlow](),
-	"return": convertFun[*ReturnFlow](),
+	"if":      convertFun[*ConditionFlow](),
+	"unless":  convertFun[*ConditionFlow](),
+	"do":      convertFun[*ActionFlow](),
+	"debug":   convertFun[*DebugFlow](),
+	"return":  convertFun[*ReturnFlow](),
+	"use":     convertFun[*UseFlow](),
+	"foreach": convertFun[*ForeachFlow](),
+	"switch":  convertFun[*SwitchFlow](),
+	"try":     convertFun[*TryFlow](),
 }
 
 func convertRawBSONToFlow(v bson.RawValue) (Flow, error) {
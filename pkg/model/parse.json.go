@@ -17,10 +17,26 @@ func jsonConverterFun[T Flow]() func(message *json.RawMessage) (Flow, error) {
 
 var jsonKeys = map[string]func(msg *json.RawMessage) (Flow, error){
 	// condition flow
-	"if":     jsonConverterFun[*ConditionFlow](),
-	"do":     jsonConverterFun[*ActionFlow](),
-	"debug":  jsonConverterFun[*DebugFlow](),
-	"return": jsonConverterFun[*ReturnFlow](),
+	"if":      jsonConverterFun[*ConditionFlow](),
+	"unless":  jsonConverterFun[*ConditionFlow](),
+	"do":      jsonConverterFun[*ActionFlow](),
+	"debug":   jsonConverterFun[*DebugFlow](),
+	"return":  jsonConverterFun[*ReturnFlow](),
+	"use":     jsonConverterFun[*UseFlow](),
+	"foreach": jsonConverterFun[*ForeachFlow](),
+	"switch":  jsonConverterFun[*SwitchFlow](),
+	"try":     jsonConverterFun[*TryFlow](),
+}
+
+// FlowTypes returns an instance of every flow kind by its key (e.g. "if")
+func FlowTypes() map[string]Flow {
+	res := make(map[string]Flow, len(jsonKeys))
+	empty := json.RawMessage("{}")
+	for k, fun := range jsonKeys {
+		// unmarshalling an empty object never fails
+		res[k], _ = fun(&empty)
+	}
+	return res
 }
 
 ///
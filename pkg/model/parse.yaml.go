@@ -35,6 +35,11 @@ var yamlKeys = map[string]func(node *yaml.Node) (Flow, error){
 		err := node.Decode(&cond)
 		return cond, err
 	},
+	"unless": func(node *yaml.Node) (Flow, error) {
+		var cond *ConditionFlow
+		err := node.Decode(&cond)
+		return cond, err
+	},
 	"do": func(node *yaml.Node) (Flow, error) {
 		var act *ActionFlow
 		err := node.Decode(&act)
@@ -50,6 +55,26 @@ var yamlKeys = map[string]func(node *yaml.Node) (Flow, error){
 		err := node.Decode(&rtf)
 		return rtf, err
 	},
+	"use": func(node *yaml.Node) (Flow, error) {
+		var use *UseFlow
+		err := node.Decode(&use)
+		return use, err
+	},
+	"foreach": func(node *yaml.Node) (Flow, error) {
+		var each *ForeachFlow
+		err := node.Decode(&each)
+		return each, err
+	},
+	"switch": func(node *yaml.Node) (Flow, error) {
+		var sw *SwitchFlow
+		err := node.Decode(&sw)
+		return sw, err
+	},
+	"try": func(node *yaml.Node) (Flow, error) {
+		var try *TryFlow
+		err := node.Decode(&try)
+		return try, err
+	},
 }
 
 var yamlTags = map[string]func(node *yaml.Node) (Flow, error){
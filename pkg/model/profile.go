@@ -1,9 +1,52 @@
 package model
 
+const (
+	// OnErrorFail stops processing the calendar if an error occurs for an event (default)
+	OnErrorFail = "fail"
+	// OnErrorSkipEvent removes events for which an error occurred
+	OnErrorSkipEvent = "skip-event"
+	// OnErrorKeepEvent keeps events for which an error occurred unchanged
+	OnErrorKeepEvent = "keep-event"
+)
+
+const (
+	// SourceConflictRename appends the source name to the UID of events of later sources (default)
+	SourceConflictRename = "rename"
+	// SourceConflictKeepFirst keeps the event of the first source
+	SourceConflictKeepFirst = "keep-first"
+	// SourceConflictKeepLast keeps the event of the last source
+	SourceConflictKeepLast = "keep-last"
+	// SourceConflictFail fails if sources contain events with the same UID
+	SourceConflictFail = "fail"
+)
+
 // Profile represents a filter profile
 type Profile struct {
-	Name          string     `yaml:"name" json:"name"`
-	Source        SomeSource `yaml:"source" json:"source"`
-	CacheDuration Duration   `yaml:"cache-duration" json:"cache-duration"`
-	Flows         Flows      `yaml:"flows" json:"flows"`
+	Name   string     `yaml:"name" json:"name"`
+	Source SomeSource `yaml:"source" json:"source"`
+	// SourceConflict specifies what happens if events of different sources have the same UID.
+	// Either "rename", "keep-first", "keep-last" or "fail". Defaults to "rename".
+	SourceConflict string   `yaml:"source-conflict,omitempty" json:"source-conflict,omitempty"`
+	CacheDuration  Duration `yaml:"cache-duration" json:"cache-duration"`
+	Flows          Flows    `yaml:"flows" json:"flows"`
+	// Definitions are named flow blocks which can be run with `use: <name>`
+	Definitions Definitions `yaml:"definitions,omitempty" json:"definitions,omitempty"`
+	// Before and After run once for the whole calendar before and after the flows ran for every event
+	Before     Flows       `yaml:"before,omitempty" json:"before,omitempty"`
+	After      Flows       `yaml:"after,omitempty" json:"after,omitempty"`
+	Recurrence *Recurrence `yaml:"recurrence,omitempty" json:"recurrence,omitempty"`
+	// Components are the component types processed by the flows (VEVENT, VTODO, VJOURNAL).
+	// Defaults to VEVENT.
+	Components []string `yaml:"components,omitempty" json:"components,omitempty"`
+	// Params are supplied when the profile is processed (e.g. as query parameters).
+	// They are available as `Params.<name>` in expressions and as `${Params.<name>}` in `with` values.
+	Params Params `yaml:"params,omitempty" json:"params,omitempty"`
+	// OnError specifies what happens to an event if an error occurs while running the flows.
+	// Either "fail", "skip-event" or "keep-event". Defaults to "fail".
+	OnError string `yaml:"on-error,omitempty" json:"on-error,omitempty"`
+	// Extends references a base profile (a file or a stored profile) which is merged into the profile.
+	// See ResolveExtends.
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
+	// Tests are end-to-end tests of the profile, see engine.RunTests
+	Tests []*Test `yaml:"tests,omitempty" json:"tests,omitempty"`
 }
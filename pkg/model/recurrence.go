@@ -0,0 +1,20 @@
+package model
+
+const (
+	// RecurrenceExpand replaces recurring events with one event per occurrence
+	RecurrenceExpand = "expand"
+	// RecurrenceExDate keeps recurring events and excludes filtered out occurrences using EXDATE.
+	// Changed occurrences are written back as overrides (RECURRENCE-ID).
+	RecurrenceExDate = "exdate"
+)
+
+// Recurrence specifies how recurring events (RRULE, RDATE) are passed to flows.
+// If set, flows run once per occurrence within the window.
+type Recurrence struct {
+	// Mode is either "expand" or "exdate"
+	Mode string `yaml:"mode" json:"mode" bson:"mode"`
+	// Past is how far occurrences before now are included (default 30 days)
+	Past Duration `yaml:"past" json:"past" bson:"past"`
+	// Future is how far occurrences after now are included (default 365 days)
+	Future Duration `yaml:"future" json:"future" bson:"future"`
+}
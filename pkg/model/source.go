@@ -8,23 +8,74 @@ import (
 	htmlsource "github.com/darmiel/ralf/pkg/source/html"
 	httpsource "github.com/darmiel/ralf/pkg/source/http"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"gopkg.in/yaml.v3"
+	"sync"
 )
 
 var (
-	ErrUnknownSourceType = errors.New("unknown source type")
-	ErrInvalidLength     = errors.New("only one source is allowed")
+	ErrUnknownSourceType   = errors.New("unknown source type")
+	ErrInvalidLength       = errors.New("at least one source is required")
+	ErrDuplicateSourceType = errors.New("source type already registered")
 )
 
-var sourceTypes = []Source{
-	&httpsource.Options{},
-	&htmlsource.Options{},
+// SourceFactory creates a new, empty instance of a source type.
+// The instance must be a pointer so it can be decoded from YAML, JSON and BSON.
+type SourceFactory func() Source
+
+var (
+	sourceTypesMu sync.RWMutex
+	// sourceTypes contains the factories of all source types in the order they were registered
+	sourceTypes []SourceFactory
+)
+
+func init() {
+	for _, factory := range []SourceFactory{
+		func() Source { return new(httpsource.Options) },
+		func() Source { return new(htmlsource.Options) },
+	} {
+		if err := RegisterSourceType(factory); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterSourceType adds a source type which can be used in the `source` of a profile.
+// The source type is selected by the `type` key which must match the KeyIdentifier of the source.
+func RegisterSourceType(factory SourceFactory) error {
+	key := factory().KeyIdentifier()
+	sourceTypesMu.Lock()
+	defer sourceTypesMu.Unlock()
+	for _, f := range sourceTypes {
+		if f().KeyIdentifier() == key {
+			return fmt.Errorf("%w: %s", ErrDuplicateSourceType, key)
+		}
+	}
+	sourceTypes = append(sourceTypes, factory)
+	return nil
 }
 
+// newSource creates a new instance of the source type with the key or returns nil if the type is unknown
+func newSource(key string) Source {
+	sourceTypesMu.RLock()
+	defer sourceTypesMu.RUnlock()
+	for _, factory := range sourceTypes {
+		if src := factory(); src.KeyIdentifier() == key {
+			return src
+		}
+	}
+	return nil
+}
+
+// sourceNameKey is the key of the source name. It must not collide with the fields of a source type,
+// e.g. `name` is the calendar name of html sources.
+const sourceNameKey = "source-name"
+
 // sourceType represents a type of source with a specific key.
 // It is only used as a helper to unmarshal the source type.
 type sourceType struct {
-	Type string `json:"type" yaml:"type"`
+	Type string `json:"type" yaml:"type" bson:"type"`
+	Name string `json:"source-name" yaml:"source-name" bson:"source-name"`
 }
 
 // Source is an interface for different types of sources, such as HTTP or HTML sources.
@@ -35,6 +86,37 @@ type Source interface {
 	Run() (*ics.Calendar, error)
 }
 
+// NamedSource is a source with a name (`source-name` in the source).
+// Events are tagged with the name of their source, see SourceName.
+type NamedSource struct {
+	Name string
+	Source
+}
+
+// SourceName returns the name of the source or its type if it has no name
+func SourceName(src Source) string {
+	if named, ok := src.(*NamedSource); ok {
+		return named.Name
+	}
+	return src.KeyIdentifier()
+}
+
+func withName(src Source, name string) Source {
+	if name == "" {
+		return src
+	}
+	return &NamedSource{Name: name, Source: src}
+}
+
+// unwrapSource returns the source without its name
+func unwrapSource(src Source) Source {
+	if named, ok := src.(*NamedSource); ok {
+		return named.Source
+	}
+	return src
+}
+
+// SomeSource contains one or more sources. It is decoded from a URL, a source or a list of both.
 type SomeSource []Source
 
 func newLegacySource(url string) Source {
@@ -43,6 +125,42 @@ func newLegacySource(url string) Source {
 	}
 }
 
+// sourceFields returns the fields of the source including `type` and `source-name`
+func sourceFields(src Source) (map[string]interface{}, error) {
+	data, err := json.Marshal(unwrapSource(src))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"] = src.KeyIdentifier()
+	if named, ok := src.(*NamedSource); ok {
+		fields[sourceNameKey] = named.Name
+	}
+	return fields, nil
+}
+
+// marshalSources returns the fields of a single source or a list of the fields of all sources
+func (s *SomeSource) marshalSources() (interface{}, error) {
+	if len(*s) == 0 {
+		return nil, ErrInvalidLength
+	}
+	res := make([]interface{}, len(*s))
+	for i, src := range *s {
+		fields, err := sourceFields(src)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = fields
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
 func (s *SomeSource) UnmarshalJSON(data []byte) error {
 	var url string
 
@@ -52,32 +170,40 @@ func (s *SomeSource) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
+	// Attempt to unmarshal data as a list of sources.
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, item := range list {
+			if err = s.UnmarshalJSON(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// Attempt to unmarshal data as a SourceType to determine the specific type of source.
 	var src sourceType
 	if err := json.Unmarshal(data, &src); err != nil {
 		return err
 	}
 
-	for _, t := range sourceTypes {
-		if t.KeyIdentifier() != src.Type {
-			continue
-		}
-		c := cloneSource(t)
-		if err := json.Unmarshal(data, c); err != nil {
-			return err
-		}
-		*s = append(*s, c)
-		return nil
+	c := newSource(src.Type)
+	if c == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSourceType, src.Type)
 	}
-
-	return ErrUnknownSourceType
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	*s = append(*s, withName(c, src.Name))
+	return nil
 }
 
 func (s *SomeSource) MarshalJSON() ([]byte, error) {
-	if len(*s) != 1 {
-		return nil, ErrInvalidLength
+	v, err := s.marshalSources()
+	if err != nil {
+		return nil, err
 	}
-	return json.Marshal((*s)[0])
+	return json.Marshal(v)
 }
 
 func (s *SomeSource) UnmarshalYAML(value *yaml.Node) error {
@@ -89,32 +215,35 @@ func (s *SomeSource) UnmarshalYAML(value *yaml.Node) error {
 		return nil
 	}
 
+	// Attempt to unmarshal data as a list of sources.
+	if value.Kind == yaml.SequenceNode {
+		for _, item := range value.Content {
+			if err := s.UnmarshalYAML(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// Attempt to unmarshal data as a SourceType to determine the specific type of source.
 	var src sourceType
 	if err := value.Decode(&src); err != nil {
 		return err
 	}
 
-	for _, t := range sourceTypes {
-		if t.KeyIdentifier() != src.Type {
-			continue
-		}
-		c := cloneSource(t)
-		if err := value.Decode(c); err != nil {
-			return err
-		}
-		*s = append(*s, c)
-		return nil
+	c := newSource(src.Type)
+	if c == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSourceType, src.Type)
 	}
-
-	return fmt.Errorf("%w: %s", ErrUnknownSourceType, src.Type)
+	if err := value.Decode(c); err != nil {
+		return err
+	}
+	*s = append(*s, withName(c, src.Name))
+	return nil
 }
 
 func (s *SomeSource) MarshalYAML() (interface{}, error) {
-	if len(*s) != 1 {
-		return nil, ErrInvalidLength
-	}
-	return (*s)[0], nil
+	return s.marshalSources()
 }
 
 func (s *SomeSource) UnmarshalBSON(data []byte) error {
@@ -126,44 +255,63 @@ func (s *SomeSource) UnmarshalBSON(data []byte) error {
 		return nil
 	}
 
+	// Attempt to unmarshal data as a list of sources (an array has the keys "0", "1", ...).
+	if elements, err := bson.Raw(data).Elements(); err == nil && len(elements) > 0 && elements[0].Key() == "0" {
+		for _, e := range elements {
+			if err = s.UnmarshalBSON(e.Value().Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// Attempt to unmarshal data as a SourceType to determine the specific type of source.
 	var src sourceType
 	if err := bson.Unmarshal(data, &src); err != nil {
 		return err
 	}
 
-	for _, t := range sourceTypes {
-		if t.KeyIdentifier() != src.Type {
-			continue
-		}
-		c := cloneSource(t)
-		if err := bson.Unmarshal(data, c); err != nil {
-			return err
-		}
-		*s = append(*s, c)
-		return nil
+	c := newSource(src.Type)
+	if c == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSourceType, src.Type)
 	}
-
-	return fmt.Errorf("%w: %s", ErrUnknownSourceType, src.Type)
+	if err := bson.Unmarshal(data, c); err != nil {
+		return err
+	}
+	*s = append(*s, withName(c, src.Name))
+	return nil
 }
 
+// MarshalBSON returns the document of a single source.
+//
+// Deprecated: lists of sources can't be marshaled as a document, SomeSource is marshaled using MarshalBSONValue.
 func (s *SomeSource) MarshalBSON() ([]byte, error) {
 	if len(*s) != 1 {
 		return nil, ErrInvalidLength
 	}
-	return bson.Marshal((*s)[0])
+	fields, err := sourceFields((*s)[0])
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(fields)
+}
+
+// MarshalBSONValue returns the document of a single source or an array of the documents of all sources
+func (s *SomeSource) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	v, err := s.marshalSources()
+	if err != nil {
+		return 0, nil, err
+	}
+	return bson.MarshalValue(v)
 }
 
-// cloneSource creates a clone of a Source interface to prevent data races and unintended modifications.
-func cloneSource(src Source) Source {
-	switch v := src.(type) {
-	case *httpsource.Options:
-		clone := *v
-		return &clone
-	case *htmlsource.Options:
-		clone := *v
-		return &clone
-	default:
-		panic(fmt.Sprintf("unhandled source type: %T", src))
+// SourceTypes returns a new instance of every registered source type
+func SourceTypes() []Source {
+	sourceTypesMu.RLock()
+	defer sourceTypesMu.RUnlock()
+	res := make([]Source, len(sourceTypes))
+	for i, factory := range sourceTypes {
+		res[i] = factory()
 	}
+	return res
 }
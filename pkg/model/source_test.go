@@ -0,0 +1,157 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	ics "github.com/darmiel/golang-ical"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+type ldapSource struct {
+	Server string `yaml:"server" json:"server" bson:"server"`
+}
+
+func (l *ldapSource) KeyIdentifier() string {
+	return "ldap"
+}
+
+func (l *ldapSource) Validate() error {
+	return nil
+}
+
+func (l *ldapSource) CacheKey() (string, error) {
+	return "ldap:" + l.Server, nil
+}
+
+func (l *ldapSource) Run() (*ics.Calendar, error) {
+	return ics.NewCalendar(), nil
+}
+
+func TestRegisterSourceType(t *testing.T) {
+	if err := RegisterSourceType(func() Source { return new(ldapSource) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterSourceType(func() Source { return new(ldapSource) }); !errors.Is(err, ErrDuplicateSourceType) {
+		t.Fatalf("expected ErrDuplicateSourceType, got %v", err)
+	}
+
+	yamlProfile, err := ParseProfileFromYAML(strings.NewReader("source:\n  type: ldap\n  server: ldap.example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonProfile, err := ParseProfileFromJSON([]byte(`{"source": {"type": "ldap", "server": "ldap.example"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bson.Marshal(bson.M{"source": bson.M{"type": "ldap", "server": "ldap.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bsonProfile Profile
+	if err = bson.Unmarshal(data, &bsonProfile); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Profile{yamlProfile, jsonProfile, &bsonProfile} {
+		src, ok := p.Source[0].(*ldapSource)
+		if !ok || src.Server != "ldap.example" {
+			t.Fatalf("expected ldap source, got %+v", p.Source)
+		}
+	}
+	// every decoded source is a new instance
+	if yamlProfile.Source[0] == jsonProfile.Source[0] {
+		t.Fatal("expected different instances")
+	}
+
+	if _, err = ParseProfileFromJSON([]byte(`{"source": {"type": "nope"}}`)); !errors.Is(err, ErrUnknownSourceType) {
+		t.Fatalf("expected ErrUnknownSourceType, got %v", err)
+	}
+	if _, err = json.Marshal(jsonProfile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultipleSources(t *testing.T) {
+	yamlProfile, err := ParseProfileFromYAML(strings.NewReader(`
+source:
+  - https://example.com/lectures.ics
+  - source-name: events
+    type: html
+    url: https://example.com/events
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(yamlProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonProfile, err := ParseProfileFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = bson.Marshal(bson.M{"source": &jsonProfile.Source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bsonProfile Profile
+	if err = bson.Unmarshal(data, &bsonProfile); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Profile{yamlProfile, jsonProfile, &bsonProfile} {
+		if len(p.Source) != 2 {
+			t.Fatalf("expected 2 sources, got %d", len(p.Source))
+		}
+		if SourceName(p.Source[0]) != "http" || SourceName(p.Source[1]) != "events" {
+			t.Fatalf("unexpected source names: %s, %s", SourceName(p.Source[0]), SourceName(p.Source[1]))
+		}
+		if p.Source[1].KeyIdentifier() != "html" {
+			t.Fatalf("expected html source, got %s", p.Source[1].KeyIdentifier())
+		}
+	}
+}
+
+func TestSourceNameKey(t *testing.T) {
+	profile, err := ParseProfileFromYAML(strings.NewReader(`
+source:
+  - type: html
+    name: Club
+    url: https://example.com/events
+  - type: html
+    name: Club
+    source-name: matches
+    url: https://example.com/matches
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// `name` is the calendar name of html sources and not the source name
+	if SourceName(profile.Source[0]) != "html" || SourceName(profile.Source[1]) != "matches" {
+		t.Fatalf("unexpected source names: %s, %s", SourceName(profile.Source[0]), SourceName(profile.Source[1]))
+	}
+	data, err := json.Marshal(&profile.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name":"Club"`) || !strings.Contains(string(data), `"source-name":"matches"`) {
+		t.Fatalf("expected calendar and source name, got %s", data)
+	}
+
+	// the deprecated MarshalBSON only supports a single source
+	single := SomeSource{profile.Source[1]}
+	data, err = single.MarshalBSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SomeSource
+	if err = decoded.UnmarshalBSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || SourceName(decoded[0]) != "matches" {
+		t.Fatalf("expected the named source, got %+v", decoded)
+	}
+	if _, err = profile.Source.MarshalBSON(); !errors.Is(err, ErrInvalidLength) {
+		t.Fatalf("expected ErrInvalidLength, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+// Test is an end-to-end test of a profile which runs the flows for an input calendar
+type Test struct {
+	Name string `yaml:"name" json:"name"`
+	// Input is an inline calendar. It can also only contain components (BEGIN:VEVENT ... END:VEVENT).
+	Input string `yaml:"input,omitempty" json:"input,omitempty"`
+	// InputFile is the path of an .ics file, relative to the profile
+	InputFile string `yaml:"input-file,omitempty" json:"input-file,omitempty"`
+	// Params are the values of the profile parameters
+	Params map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+	Expect TestExpectation   `yaml:"expect" json:"expect"`
+}
+
+// TestExpectation describes the expected result of a test
+type TestExpectation struct {
+	// Kept and Removed contain UIDs of events which must (not) be in the output
+	Kept    []string `yaml:"kept,omitempty" json:"kept,omitempty"`
+	Removed []string `yaml:"removed,omitempty" json:"removed,omitempty"`
+	// Count is the number of events in the output
+	Count *int `yaml:"count,omitempty" json:"count,omitempty"`
+	// Events contains the expected property values by UID and property name.
+	// A null value expects the property to be missing.
+	Events map[string]map[string]*string `yaml:"events,omitempty" json:"events,omitempty"`
+	// Error is a part of the expected error message if the profile should fail
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+}
@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/model"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	FormatICS  = "ics"
+	FormatJCal = "jcal"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultWorkers = 1
+)
+
+var ErrInvalidConfig = errors.New("invalid plugin config")
+
+// Config declares an action which is executed by a local executable
+type Config struct {
+	// Identifier is used in flows, e.g. `do: plugins/room-lookup`
+	Identifier string   `yaml:"identifier" json:"identifier"`
+	Command    string   `yaml:"command" json:"command"`
+	Args       []string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Env is appended to the environment of the server (KEY=value)
+	Env []string `yaml:"env,omitempty" json:"env,omitempty"`
+	// Format of the event sent to the plugin: ics (default) or jcal
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// Timeout for a single event (default: 5s)
+	Timeout model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Workers is the maximum number of processes running in parallel (default: 1)
+	Workers int `yaml:"workers,omitempty" json:"workers,omitempty"`
+}
+
+// File is the plugin section of the server config
+type File struct {
+	Plugins []*Config `yaml:"plugins" json:"plugins"`
+}
+
+func (c *Config) validate() error {
+	if c.Identifier == "" {
+		return fmt.Errorf("%w: identifier required", ErrInvalidConfig)
+	}
+	if c.Command == "" {
+		return fmt.Errorf("%w: %s: command required", ErrInvalidConfig, c.Identifier)
+	}
+	switch c.Format {
+	case "":
+		c.Format = FormatICS
+	case FormatICS, FormatJCal:
+	default:
+		return fmt.Errorf("%w: %s: unknown format '%s'", ErrInvalidConfig, c.Identifier, c.Format)
+	}
+	if c.Timeout < 0 || c.Workers < 0 {
+		return fmt.Errorf("%w: %s: timeout and workers must not be negative", ErrInvalidConfig, c.Identifier)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = model.Duration(DefaultTimeout)
+	}
+	if c.Workers == 0 {
+		c.Workers = DefaultWorkers
+	}
+	return nil
+}
+
+// Load reads plugin declarations from a YAML (or JSON) config
+func Load(r io.Reader) ([]*Config, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var file File
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return file.Plugins, nil
+}
+
+// RegisterFile registers all plugins declared in the config file as actions
+func RegisterFile(path string) ([]*Action, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	configs, err := Load(f)
+	if err != nil {
+		return nil, err
+	}
+	var registered []*Action
+	for _, cfg := range configs {
+		act, err := New(cfg)
+		if err != nil {
+			return registered, err
+		}
+		if err = actions.Register(act); err != nil {
+			return registered, err
+		}
+		registered = append(registered, act)
+	}
+	return registered, nil
+}
@@ -0,0 +1,327 @@
+package plugin
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"strconv"
+	"strings"
+)
+
+// jcalTypes contains the default value types of the known properties (RFC 5545, RFC 7986).
+// Properties not listed here use the type "unknown" unless they have a VALUE parameter.
+var jcalTypes = map[string]string{
+	"DTSTART":          "date-time",
+	"DTEND":            "date-time",
+	"DUE":              "date-time",
+	"DTSTAMP":          "date-time",
+	"CREATED":          "date-time",
+	"LAST-MODIFIED":    "date-time",
+	"COMPLETED":        "date-time",
+	"RECURRENCE-ID":    "date-time",
+	"EXDATE":           "date-time",
+	"RDATE":            "date-time",
+	"DURATION":         "duration",
+	"TRIGGER":          "duration",
+	"REFRESH-INTERVAL": "duration",
+	"SEQUENCE":         "integer",
+	"PRIORITY":         "integer",
+	"PERCENT-COMPLETE": "integer",
+	"REPEAT":           "integer",
+	"GEO":              "float",
+	"URL":              "uri",
+	"ATTACH":           "uri",
+	"TZURL":            "uri",
+	"SOURCE":           "uri",
+	"IMAGE":            "uri",
+	"CONFERENCE":       "uri",
+	"ORGANIZER":        "cal-address",
+	"ATTENDEE":         "cal-address",
+	"RRULE":            "recur",
+	"EXRULE":           "recur",
+	"TZOFFSETFROM":     "utc-offset",
+	"TZOFFSETTO":       "utc-offset",
+	"SUMMARY":          "text",
+	"DESCRIPTION":      "text",
+	"LOCATION":         "text",
+	"COMMENT":          "text",
+	"CATEGORIES":       "text",
+	"RESOURCES":        "text",
+	"CONTACT":          "text",
+	"RELATED-TO":       "text",
+	"UID":              "text",
+	"STATUS":           "text",
+	"CLASS":            "text",
+	"TRANSP":           "text",
+	"ACTION":           "text",
+	"TZID":             "text",
+	"TZNAME":           "text",
+	"COLOR":            "text",
+	"NAME":             "text",
+}
+
+// jcalMultiValued contains the properties with a comma separated list of values
+var jcalMultiValued = map[string]bool{
+	"EXDATE":     true,
+	"RDATE":      true,
+	"CATEGORIES": true,
+	"RESOURCES":  true,
+}
+
+// jcalValueTypes contains the value types which can be set with the VALUE parameter
+var jcalValueTypes = map[string]bool{
+	"binary":      true,
+	"boolean":     true,
+	"cal-address": true,
+	"date":        true,
+	"date-time":   true,
+	"duration":    true,
+	"float":       true,
+	"integer":     true,
+	"period":      true,
+	"recur":       true,
+	"text":        true,
+	"time":        true,
+	"uri":         true,
+	"utc-offset":  true,
+}
+
+// jcalRecurNumeric contains the recurrence rule parts with integer values
+var jcalRecurNumeric = map[string]bool{
+	"COUNT":      true,
+	"INTERVAL":   true,
+	"BYSECOND":   true,
+	"BYMINUTE":   true,
+	"BYHOUR":     true,
+	"BYMONTHDAY": true,
+	"BYYEARDAY":  true,
+	"BYWEEKNO":   true,
+	"BYMONTH":    true,
+	"BYSETPOS":   true,
+}
+
+// encodeJCal converts the component into jCal (RFC 7265).
+// Properties without a known type use the type "unknown" and are passed as in the ICS representation.
+func encodeJCal(name string, base *ics.ComponentBase) []interface{} {
+	props := make([]interface{}, 0, len(base.Properties))
+	for _, p := range base.Properties {
+		props = append(props, encodeJCalProperty(&p.BaseProperty))
+	}
+	subs := make([]interface{}, 0, len(base.Components))
+	for _, sub := range base.Components {
+		switch v := sub.(type) {
+		case *ics.VAlarm:
+			subs = append(subs, encodeJCal("valarm", &v.ComponentBase))
+		case *ics.GeneralComponent:
+			subs = append(subs, encodeJCal(strings.ToLower(v.Token), &v.ComponentBase))
+		}
+	}
+	return []interface{}{name, props, subs}
+}
+
+// encodeJCalProperty converts a property into [name, params, type, values...]
+func encodeJCalProperty(p *ics.BaseProperty) []interface{} {
+	name := strings.ToUpper(p.IANAToken)
+	typ, ok := jcalTypes[name]
+	params := make(map[string]interface{}, len(p.ICalParameters))
+	for k, v := range p.ICalParameters {
+		// the value type replaces the VALUE parameter
+		if strings.EqualFold(k, "VALUE") && len(v) == 1 {
+			typ = strings.ToLower(v[0])
+			ok = jcalValueTypes[typ]
+			continue
+		}
+		if len(v) == 1 {
+			params[strings.ToLower(k)] = v[0]
+		} else {
+			params[strings.ToLower(k)] = v
+		}
+	}
+	if !ok {
+		return []interface{}{strings.ToLower(name), params, "unknown", p.Value}
+	}
+	raw := []string{p.Value}
+	if jcalMultiValued[name] {
+		raw = splitJCalValues(p.Value)
+	}
+	values := make([]interface{}, 0, len(raw))
+	for _, v := range raw {
+		value, valid := jcalValue(typ, v)
+		if !valid {
+			// keep the property but don't claim a type the value doesn't have
+			return []interface{}{strings.ToLower(name), params, "unknown", p.Value}
+		}
+		values = append(values, value)
+	}
+	return append([]interface{}{strings.ToLower(name), params, typ}, values...)
+}
+
+// jcalValue converts a single ICS value into its jCal representation
+func jcalValue(typ, value string) (interface{}, bool) {
+	switch typ {
+	case "text":
+		return ics.FromText(value), true
+	case "date":
+		return jcalDate(value)
+	case "date-time":
+		return jcalDateTime(value)
+	case "integer":
+		i, err := strconv.Atoi(value)
+		return i, err == nil
+	case "float":
+		// GEO is a structured value of latitude and longitude
+		parts := strings.Split(value, ";")
+		floats := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			f, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, false
+			}
+			floats = append(floats, f)
+		}
+		if len(floats) == 1 {
+			return floats[0], true
+		}
+		return floats, true
+	case "time":
+		return jcalTime(value)
+	case "utc-offset":
+		return jcalUTCOffset(value)
+	case "period":
+		start, end, found := strings.Cut(value, "/")
+		if !found {
+			return nil, false
+		}
+		s, ok := jcalDateTime(start)
+		if !ok {
+			return nil, false
+		}
+		// the end is either a date-time or a duration
+		if e, ok := jcalDateTime(end); ok {
+			return []interface{}{s, e}, true
+		}
+		return []interface{}{s, end}, true
+	case "recur":
+		return jcalRecur(value)
+	}
+	// duration, uri, cal-address, binary and boolean values are passed as they are
+	return value, true
+}
+
+// jcalDate converts 20230102 into 2023-01-02
+func jcalDate(value string) (interface{}, bool) {
+	if len(value) != 8 || !isDigits(value) {
+		return nil, false
+	}
+	return value[:4] + "-" + value[4:6] + "-" + value[6:], true
+}
+
+// jcalDateTime converts 20230102T100000(Z) into 2023-01-02T10:00:00(Z)
+func jcalDateTime(value string) (interface{}, bool) {
+	date, clock, found := strings.Cut(value, "T")
+	if !found {
+		return nil, false
+	}
+	d, ok := jcalDate(date)
+	if !ok {
+		return nil, false
+	}
+	t, ok := jcalTime(clock)
+	if !ok {
+		return nil, false
+	}
+	return d.(string) + "T" + t.(string), true
+}
+
+// jcalTime converts 100000(Z) into 10:00:00(Z)
+func jcalTime(value string) (interface{}, bool) {
+	utc := strings.HasSuffix(value, "Z")
+	value = strings.TrimSuffix(value, "Z")
+	if len(value) != 6 || !isDigits(value) {
+		return nil, false
+	}
+	res := value[:2] + ":" + value[2:4] + ":" + value[4:]
+	if utc {
+		res += "Z"
+	}
+	return res, true
+}
+
+// jcalUTCOffset converts +0100 into +01:00
+func jcalUTCOffset(value string) (interface{}, bool) {
+	if (len(value) != 5 && len(value) != 7) || (value[0] != '+' && value[0] != '-') || !isDigits(value[1:]) {
+		return nil, false
+	}
+	res := value[:3] + ":" + value[3:5]
+	if len(value) == 7 {
+		res += ":" + value[5:]
+	}
+	return res, true
+}
+
+// jcalRecur converts a recurrence rule into an object with lowercase keys
+func jcalRecur(value string) (interface{}, bool) {
+	rule := make(map[string]interface{})
+	for _, part := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(part, "=")
+		if !found {
+			return nil, false
+		}
+		key = strings.ToUpper(key)
+		var values []interface{}
+		for _, v := range strings.Split(val, ",") {
+			switch {
+			case jcalRecurNumeric[key]:
+				i, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, false
+				}
+				values = append(values, i)
+			case key == "UNTIL":
+				if d, ok := jcalDateTime(v); ok {
+					values = append(values, d)
+				} else if d, ok = jcalDate(v); ok {
+					values = append(values, d)
+				} else {
+					return nil, false
+				}
+			default:
+				values = append(values, v)
+			}
+		}
+		if len(values) == 1 {
+			rule[strings.ToLower(key)] = values[0]
+		} else {
+			rule[strings.ToLower(key)] = values
+		}
+	}
+	return rule, true
+}
+
+// splitJCalValues splits a list of values on commas which are not escaped
+func splitJCalValues(value string) []string {
+	var (
+		res     []string
+		start   int
+		escaped bool
+	)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case value[i] == '\\':
+			escaped = true
+		case value[i] == ',':
+			res = append(res, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, value[start:])
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,86 @@
+// Package plugin executes actions in local executables using a JSON protocol over stdin / stdout
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/darmiel/ralf/pkg/actions"
+)
+
+var ErrPlugin = errors.New("plugin error")
+
+// Action is an action which is executed by a plugin process
+type Action struct {
+	cfg  *Config
+	pool *pool
+}
+
+// New creates an action from the config. Processes are started on first use.
+func New(cfg *Config) (*Action, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Action{cfg: cfg, pool: newPool(cfg)}, nil
+}
+
+func (a *Action) Identifier() string {
+	return a.cfg.Identifier
+}
+
+// Schema allows any `with` values since they are validated by the plugin
+func (a *Action) Schema() *actions.Schema {
+	return &actions.Schema{Dynamic: true}
+}
+
+func (a *Action) Execute(ctx *actions.Context) (actions.ActionMessage, error) {
+	req := &Request{
+		Action:  a.cfg.Identifier,
+		With:    ctx.With,
+		Context: ctx.SharedContext,
+		Params:  ctx.Params,
+	}
+	req.setEvent(a.cfg.Format, ctx.Component)
+
+	resp, err := a.pool.call(req)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", a.cfg.Identifier, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: [%s] %s", ErrPlugin, a.cfg.Identifier, resp.Error)
+	}
+
+	var msg actions.ActionMessage
+	switch resp.Verdict {
+	case "":
+	case VerdictFilterIn:
+		msg = new(actions.FilterInActionMessage)
+	case VerdictFilterOut:
+		msg = new(actions.FilterOutActionMessage)
+	default:
+		return nil, fmt.Errorf("%w: [%s] unknown verdict '%s'", ErrInvalidResponse, a.cfg.Identifier, resp.Verdict)
+	}
+
+	for _, change := range resp.Changes {
+		if change.Property == "" {
+			return nil, fmt.Errorf("%w: [%s] change without property", ErrInvalidResponse, a.cfg.Identifier)
+		}
+	}
+	for _, change := range resp.Changes {
+		change.apply(ctx.Component)
+	}
+	for k, v := range resp.Context {
+		if v == nil {
+			delete(ctx.SharedContext, k)
+		} else {
+			ctx.SharedContext[k] = v
+		}
+	}
+	ctx.Logf("[%s] applied %d change(s), %d context update(s), verdict: '%s'",
+		a.cfg.Identifier, len(resp.Changes), len(resp.Context), resp.Verdict)
+	return msg, nil
+}
+
+// Close stops all idle plugin processes
+func (a *Action) Close() {
+	a.pool.close()
+}
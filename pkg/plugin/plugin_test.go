@@ -0,0 +1,245 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/environ"
+	"github.com/darmiel/ralf/pkg/model"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is started as plugin process by the other tests
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("RALF_HELPER_PLUGIN") != "1" {
+		t.Skip("helper process")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1<<20)
+	out := json.NewEncoder(os.Stdout)
+	calls := 0
+	for scanner.Scan() {
+		calls++
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			_ = out.Encode(&Response{Error: err.Error()})
+			continue
+		}
+		var summary string
+		switch event := req.Event.(type) {
+		case string:
+			for _, line := range strings.Split(event, "\r\n") {
+				if strings.HasPrefix(line, "SUMMARY:") {
+					summary = strings.TrimPrefix(line, "SUMMARY:")
+				}
+			}
+		case []interface{}:
+			for _, prop := range event[1].([]interface{}) {
+				if p := prop.([]interface{}); p[0] == "summary" {
+					summary = p[3].(string)
+				}
+			}
+		}
+		switch req.With["mode"] {
+		case "rename":
+			_ = out.Encode(&Response{
+				Changes: []*Change{
+					{Property: "summary", Value: fmt.Sprint(req.With["prefix"]) + summary},
+					{Property: "LOCATION", Remove: true},
+				},
+				Context: map[string]interface{}{"format": req.Format, "calls": calls, "old": nil},
+			})
+		case "drop":
+			_ = out.Encode(&Response{Verdict: VerdictFilterOut})
+		case "sleep":
+			time.Sleep(5 * time.Second)
+		case "crash":
+			os.Exit(1)
+		default:
+			_ = out.Encode(&Response{Error: "unknown mode"})
+		}
+	}
+	os.Exit(0)
+}
+
+func helperAction(t *testing.T, format string, timeout time.Duration) *Action {
+	act, err := New(&Config{
+		Identifier: "plugins/test",
+		Command:    os.Args[0],
+		Args:       []string{"-test.run=^TestHelperPlugin$"},
+		Env:        []string{"RALF_HELPER_PLUGIN=1"},
+		Format:     format,
+		Timeout:    model.Duration(timeout),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(act.Close)
+	return act
+}
+
+func testContext(mode string) *actions.Context {
+	event := ics.NewEvent("event-1")
+	event.SetSummary("Math")
+	event.SetLocation("Room 1")
+	return &actions.Context{
+		Component:     environ.NewComponent(event),
+		SharedContext: map[string]interface{}{"old": true},
+		With:          map[string]interface{}{"mode": mode, "prefix": "[Plugin] "},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	for _, format := range []string{FormatICS, FormatJCal} {
+		act := helperAction(t, format, 5*time.Second)
+		for i := 1; i <= 2; i++ {
+			ctx := testContext("rename")
+			msg, err := act.Execute(ctx)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if msg != nil {
+				t.Fatalf("%s: expected no verdict, got %T", format, msg)
+			}
+			if got := ctx.Component.GetProperty(ics.ComponentPropertySummary).Value; got != "[Plugin] Math" {
+				t.Fatalf("%s: expected changed summary, got '%s'", format, got)
+			}
+			if ctx.Component.GetProperty(ics.ComponentPropertyLocation) != nil {
+				t.Fatalf("%s: expected location to be removed", format)
+			}
+			if ctx.SharedContext["format"] != format {
+				t.Fatalf("%s: expected context update, got %v", format, ctx.SharedContext)
+			}
+			if _, ok := ctx.SharedContext["old"]; ok {
+				t.Fatalf("%s: expected 'old' to be deleted", format)
+			}
+			// the process is kept running between events
+			if ctx.SharedContext["calls"] != float64(i) {
+				t.Fatalf("%s: expected call %d, got %v", format, i, ctx.SharedContext["calls"])
+			}
+		}
+	}
+}
+
+func TestExecuteVerdict(t *testing.T) {
+	msg, err := helperAction(t, FormatICS, 5*time.Second).Execute(testContext("drop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.(*actions.FilterOutActionMessage); !ok {
+		t.Fatalf("expected filter-out, got %T", msg)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	act := helperAction(t, FormatICS, 500*time.Millisecond)
+	if _, err := act.Execute(testContext("unknown")); !errors.Is(err, ErrPlugin) {
+		t.Fatalf("expected ErrPlugin, got %v", err)
+	}
+	if _, err := act.Execute(testContext("sleep")); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if _, err := act.Execute(testContext("crash")); err == nil {
+		t.Fatal("expected error for crashed plugin")
+	}
+	// killed processes are restarted
+	if _, err := act.Execute(testContext("rename")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeJCal(t *testing.T) {
+	cal, err := ics.ParseCalendar(strings.NewReader(strings.ReplaceAll(`BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:event-1
+DTSTART;TZID=Europe/Berlin:20230102T100000
+DTEND;VALUE=DATE:20230103
+DTSTAMP:20230101T080000Z
+DURATION:PT1H
+SEQUENCE:2
+GEO:37.386013;-122.082932
+URL:https://example.com/event
+ORGANIZER;CN=Jane:mailto:jane@example.com
+RRULE:FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE;UNTIL=20230301T000000Z
+EXDATE:20230109T100000,20230116T100000
+SUMMARY:Math\, Physics\nand more
+CATEGORIES:Lecture,Room\, 1
+X-CUSTOM:a\,b
+SEQUENCE:second
+BEGIN:VALARM
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cal.Events()[0]
+	got := encodeJCal("vevent", &event.ComponentBase)
+	expected := []string{
+		`["uid",{},"text","event-1"]`,
+		`["dtstart",{"tzid":"Europe/Berlin"},"date-time","2023-01-02T10:00:00"]`,
+		`["dtend",{},"date","2023-01-03"]`,
+		`["dtstamp",{},"date-time","2023-01-01T08:00:00Z"]`,
+		`["duration",{},"duration","PT1H"]`,
+		`["sequence",{},"integer",2]`,
+		`["geo",{},"float",[37.386013,-122.082932]]`,
+		`["url",{},"uri","https://example.com/event"]`,
+		`["organizer",{"cn":"Jane"},"cal-address","mailto:jane@example.com"]`,
+		`["rrule",{},"recur",{"byday":["MO","WE"],"count":10,"freq":"WEEKLY","until":"2023-03-01T00:00:00Z"}]`,
+		`["exdate",{},"date-time","2023-01-09T10:00:00","2023-01-16T10:00:00"]`,
+		`["summary",{},"text","Math, Physics\nand more"]`,
+		`["categories",{},"text","Lecture","Room, 1"]`,
+		`["x-custom",{},"unknown","a\\,b"]`,
+		// invalid values are passed as they are
+		`["sequence",{},"unknown","second"]`,
+	}
+	props := got[1].([]interface{})
+	if len(props) != len(expected) {
+		t.Fatalf("expected %d properties, got %d", len(expected), len(props))
+	}
+	for i, prop := range props {
+		data, err := json.Marshal(prop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], data)
+		}
+	}
+	alarm, err := json.Marshal(got[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(alarm) != `[["valarm",[["trigger",{},"duration","-PT15M"]],[]]]` {
+		t.Fatalf("unexpected alarm: %s", alarm)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	configs, err := Load(strings.NewReader(`
+plugins:
+  - identifier: plugins/room-lookup
+    command: python3
+    args: [room_lookup.py]
+    format: jcal
+    timeout: 2s
+    workers: 4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Workers != 4 || time.Duration(configs[0].Timeout) != 2*time.Second {
+		t.Fatalf("unexpected config: %+v", configs)
+	}
+	if _, err = New(&Config{Identifier: "plugins/x", Command: "x", Format: "xml"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+}
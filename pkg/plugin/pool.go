@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var (
+	ErrTimeout         = errors.New("plugin timed out")
+	ErrInvalidResponse = errors.New("invalid plugin response")
+)
+
+// process is a running plugin which handles one request per line
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func (p *process) roundTrip(req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.stdin.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	line, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err = json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return &resp, nil
+}
+
+func (p *process) kill() {
+	_ = p.stdin.Close()
+	_ = p.cmd.Process.Kill()
+	_ = p.cmd.Wait()
+}
+
+// pool limits the number of plugin processes and keeps them running between events.
+// A slot is nil if its process has not been started yet or was killed.
+type pool struct {
+	cfg   *Config
+	slots chan *process
+}
+
+func newPool(cfg *Config) *pool {
+	p := &pool{cfg: cfg, slots: make(chan *process, cfg.Workers)}
+	for i := 0; i < cfg.Workers; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+func (p *pool) start() (*process, error) {
+	cmd := exec.Command(p.cfg.Command, p.cfg.Args...)
+	cmd.Env = append(os.Environ(), p.cfg.Env...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &process{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// call sends the request to an idle process (or starts one).
+// Processes which time out or fail to respond are killed and restarted on the next call.
+func (p *pool) call(req *Request) (*Response, error) {
+	timeout := time.Duration(p.cfg.Timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var proc *process
+	select {
+	case proc = <-p.slots:
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: no worker available after %v", ErrTimeout, timeout)
+	}
+	if proc == nil {
+		var err error
+		if proc, err = p.start(); err != nil {
+			p.slots <- nil
+			return nil, err
+		}
+	}
+
+	type result struct {
+		resp *Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := proc.roundTrip(req)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			proc.kill()
+			p.slots <- nil
+			return nil, res.err
+		}
+		p.slots <- proc
+		return res.resp, nil
+	case <-timer.C:
+		proc.kill()
+		p.slots <- nil
+		return nil, fmt.Errorf("%w after %v", ErrTimeout, timeout)
+	}
+}
+
+// close stops all idle processes
+func (p *pool) close() {
+	for i := 0; i < cap(p.slots); i++ {
+		if proc := <-p.slots; proc != nil {
+			proc.kill()
+		}
+		p.slots <- nil
+	}
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	ics "github.com/darmiel/golang-ical"
+	"github.com/darmiel/ralf/pkg/environ"
+	"strings"
+)
+
+// Request is written to the plugin as a single line of JSON
+type Request struct {
+	Action string `json:"action"`
+	Format string `json:"format"`
+	// Event is the raw component (ics) or a jCal array (jcal)
+	Event   interface{}            `json:"event"`
+	With    map[string]interface{} `json:"with"`
+	Context map[string]interface{} `json:"context"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+// Change modifies a property of the event.
+// Without Remove or Add, all properties with the name are replaced by the value.
+type Change struct {
+	Property string              `json:"property"`
+	Value    string              `json:"value,omitempty"`
+	Params   map[string][]string `json:"params,omitempty"`
+	Remove   bool                `json:"remove,omitempty"`
+	Add      bool                `json:"add,omitempty"`
+}
+
+// Response is read from the plugin as a single line of JSON
+type Response struct {
+	Changes []*Change `json:"changes,omitempty"`
+	// Context is merged into the shared context, null values delete a key
+	Context map[string]interface{} `json:"context,omitempty"`
+	// Verdict is either empty, filter-in or filter-out
+	Verdict string `json:"verdict,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+const (
+	VerdictFilterIn  = "filter-in"
+	VerdictFilterOut = "filter-out"
+)
+
+// encodeICS serializes the component (BEGIN:VEVENT ... END:VEVENT)
+func encodeICS(c *environ.Component) string {
+	var wrapped ics.Component
+	switch c.Type {
+	case ics.ComponentVTodo:
+		wrapped = &ics.VTodo{ComponentBase: *c.ComponentBase}
+	case ics.ComponentVJournal:
+		wrapped = &ics.VJournal{ComponentBase: *c.ComponentBase}
+	default:
+		wrapped = &ics.VEvent{ComponentBase: *c.ComponentBase}
+	}
+	cal := ics.NewCalendar()
+	cal.Components = append(cal.Components, wrapped)
+	str := cal.Serialize()
+	// strip the calendar around the component
+	start := strings.Index(str, "BEGIN:"+string(c.Type))
+	end := strings.LastIndex(str, "END:"+string(c.Type))
+	if start < 0 || end < 0 {
+		return str
+	}
+	return str[start:end] + "END:" + string(c.Type) + "\r\n"
+}
+
+func (r *Request) setEvent(format string, c *environ.Component) {
+	r.Format = format
+	if format == FormatJCal {
+		r.Event = encodeJCal(strings.ToLower(string(c.Type)), c.ComponentBase)
+	} else {
+		r.Event = encodeICS(c)
+	}
+}
+
+// apply applies the property changes to the component
+func (ch *Change) apply(c *environ.Component) {
+	name := strings.ToUpper(ch.Property)
+	if ch.Remove || !ch.Add {
+		for i := len(c.Properties) - 1; i >= 0; i-- {
+			if c.Properties[i].IANAToken == name {
+				c.Properties = append(c.Properties[:i], c.Properties[i+1:]...)
+			}
+		}
+	}
+	if ch.Remove {
+		return
+	}
+	params := make(map[string][]string, len(ch.Params))
+	for k, v := range ch.Params {
+		params[strings.ToUpper(k)] = v
+	}
+	c.Properties = append(c.Properties, ics.IANAProperty{BaseProperty: ics.BaseProperty{
+		IANAToken:      name,
+		ICalParameters: params,
+		Value:          ch.Value,
+	}})
+}
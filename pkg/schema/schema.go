@@ -0,0 +1,304 @@
+// Package schema generates a JSON Schema for RALF profiles.
+// The schema is generated from the model, the registered source types and the parameters of all actions,
+// so it doesn't need to be updated when flows, sources or actions are added.
+package schema
+
+import (
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/model"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// references to the flows in definitions
+const (
+	eventFlowsRef    = "#/definitions/flows"
+	calendarFlowsRef = "#/definitions/calendar-flows"
+	conditionRef     = "#/definitions/condition"
+)
+
+// paramReference matches `${Params.<name>}` which can be used instead of any `with` value
+var paramReference = object{
+	"type":    "string",
+	"pattern": `^\$\{Params\.[^}]+}$`,
+}
+
+type object = map[string]interface{}
+
+var (
+	flowsType       = reflect.TypeOf(model.Flows{})
+	durationType    = reflect.TypeOf(model.Duration(0))
+	conditionsType  = reflect.TypeOf(model.Conditions{})
+	someSourceType  = reflect.TypeOf(model.SomeSource{})
+	definitionsType = reflect.TypeOf(model.Definitions{})
+	actionFlowType  = reflect.TypeOf(&model.ActionFlow{})
+	returnType      = reflect.TypeOf(model.ReturnValue{})
+)
+
+// Generate returns the JSON Schema of a profile
+func Generate() object {
+	var eventActions, calendarActions []*actionSchema
+	for _, act := range actions.List() {
+		eventActions = append(eventActions, newActionSchema(act.Identifier(), act))
+	}
+	for _, act := range actions.ListCalendar() {
+		calendarActions = append(calendarActions, newActionSchema(act.Identifier(), act))
+	}
+
+	profile := typeSchema(reflect.TypeOf(model.Profile{}), eventFlowsRef)
+	profile["$schema"] = Draft
+	profile["title"] = "RALF profile"
+	props := profile["properties"].(object)
+	props["before"] = object{"$ref": calendarFlowsRef}
+	props["after"] = object{"$ref": calendarFlowsRef}
+
+	profile["definitions"] = object{
+		"flows":          flowsSchema(eventFlowsRef, eventActions),
+		"calendar-flows": flowsSchema(calendarFlowsRef, calendarActions),
+		"condition":      conditionSchema(),
+	}
+	return profile
+}
+
+type actionSchema struct {
+	identifier string
+	schema     *actions.Schema
+}
+
+// newActionSchema returns the schema of an action, actions without a schema allow any `with` values
+func newActionSchema(identifier string, act interface{}) *actionSchema {
+	schema := actions.SchemaOf(act)
+	if schema == nil {
+		schema = &actions.Schema{Dynamic: true}
+	}
+	return &actionSchema{identifier, schema}
+}
+
+// flowsSchema returns the schema of a list of flows.
+// Action flows are split into one schema per action to describe their `with` values.
+func flowsSchema(ref string, acts []*actionSchema) object {
+	kinds := model.FlowTypes()
+	keys := make([]string, 0, len(kinds))
+	for k := range kinds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var oneOf []interface{}
+	for _, k := range keys {
+		t := reflect.TypeOf(kinds[k])
+		if t == actionFlowType {
+			for _, act := range acts {
+				oneOf = append(oneOf, actionFlowSchema(act))
+			}
+			continue
+		}
+		s := typeSchema(t, ref)
+		s["required"] = []string{k}
+		oneOf = append(oneOf, s)
+	}
+	return object{
+		"type":  "array",
+		"items": object{"oneOf": oneOf},
+	}
+}
+
+func actionFlowSchema(act *actionSchema) object {
+	with := object{
+		"type":                 "object",
+		"additionalProperties": act.schema.Dynamic,
+	}
+	props := object{}
+	var required []string
+	for _, p := range act.schema.Parameters {
+		props[p.Name] = parameterSchema(p)
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	with["properties"] = props
+	if len(required) > 0 {
+		with["required"] = required
+	}
+	if len(act.schema.OneOf) > 0 {
+		var groups []interface{}
+		for _, group := range act.schema.OneOf {
+			groups = append(groups, object{"required": group})
+		}
+		with["oneOf"] = groups
+	}
+	return object{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": object{
+			"do":   object{"const": act.identifier},
+			"with": with,
+		},
+		"required": []string{"do"},
+	}
+}
+
+func parameterSchema(p *actions.Parameter) object {
+	var s object
+	switch p.Type {
+	case actions.TypeString, actions.TypeExpression:
+		s = object{"type": "string"}
+	case actions.TypeBool:
+		s = object{"type": "boolean"}
+	case actions.TypeInt:
+		s = object{"type": "integer"}
+	case actions.TypeList:
+		s = object{"type": "array"}
+	default:
+		s = object{}
+	}
+	if p.Description != "" {
+		s["description"] = p.Description
+	}
+	if len(p.Enum) > 0 {
+		s["enum"] = p.Enum
+	}
+	// every value can also reference a parameter of the profile
+	if p.Type != actions.TypeString && p.Type != actions.TypeExpression && p.Type != actions.TypeAny {
+		return object{"anyOf": []interface{}{s, paramReference}}
+	}
+	return s
+}
+
+// sourceSchema returns the schema of all registered source types and the legacy URL (or a list of them)
+func sourceSchema() object {
+	oneOf := []interface{}{
+		object{"type": "string", "description": "URL of the calendar"},
+	}
+	for _, src := range model.SourceTypes() {
+		s := typeSchema(reflect.TypeOf(src), eventFlowsRef)
+		s["properties"].(object)["type"] = object{"const": src.KeyIdentifier()}
+		s["properties"].(object)["source-name"] = object{
+			"type":        "string",
+			"description": "name of the source, available as Event.Source() (default: type)",
+		}
+		s["required"] = []string{"type"}
+		oneOf = append(oneOf, s)
+	}
+	single := object{"oneOf": oneOf}
+	return object{"oneOf": []interface{}{
+		single,
+		object{"type": "array", "minItems": 1, "items": single},
+	}}
+}
+
+// conditionSchema returns the schema of an expression or a (nested) group of conditions
+func conditionSchema() object {
+	group := func(name string, value object) object {
+		return object{
+			"type":                 "object",
+			"properties":           object{name: value},
+			"required":             []string{name},
+			"additionalProperties": false,
+		}
+	}
+	list := object{"type": "array", "minItems": 1, "items": object{"$ref": conditionRef}}
+	return object{"oneOf": []interface{}{
+		object{"type": "string"},
+		group(model.ConditionAll, list),
+		group(model.ConditionAny, list),
+		group(model.ConditionNot, object{"$ref": conditionRef}),
+	}}
+}
+
+// typeSchema returns the schema of a Go type using the yaml names of struct fields
+func typeSchema(t reflect.Type, flowsRef string) object {
+	switch t {
+	case flowsType:
+		return object{"$ref": flowsRef}
+	case durationType:
+		return object{
+			"description": "duration, e.g. 1h30m",
+			"type":        []string{"string", "integer"},
+		}
+	case conditionsType:
+		return object{
+			"oneOf": []interface{}{
+				object{"$ref": conditionRef},
+				object{"type": "array", "items": object{"$ref": conditionRef}},
+			},
+		}
+	case returnType:
+		return object{
+			"oneOf": []interface{}{
+				object{"type": "boolean"},
+				object{"enum": []string{model.ReturnKeep, model.ReturnDrop}},
+			},
+		}
+	case someSourceType:
+		return sourceSchema()
+	case definitionsType:
+		return object{
+			"type":                 "object",
+			"additionalProperties": object{"$ref": eventFlowsRef},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), flowsRef)
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": typeSchema(t.Elem(), flowsRef)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(t.Elem(), flowsRef)}
+	case reflect.Struct:
+		props := object{}
+		structProperties(t, flowsRef, props)
+		return object{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+	}
+	// interface{}
+	return object{}
+}
+
+// structProperties adds the schema of all fields of a struct to props.
+// The fields of embedded structs and `,inline` fields are added as if they were fields of the struct.
+func structProperties(t reflect.Type, flowsRef string, props object) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		inline := name == "" && field.Anonymous
+		for _, opt := range tag[1:] {
+			inline = inline || opt == "inline"
+		}
+		if inline && ft.Kind() == reflect.Struct {
+			structProperties(ft, flowsRef, props)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		props[name] = typeSchema(field.Type, flowsRef)
+	}
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/darmiel/ralf/pkg/actions"
+	"github.com/darmiel/ralf/pkg/model"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	data, err := json.Marshal(Generate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := string(data)
+	var expected []string
+	for _, act := range actions.List() {
+		expected = append(expected, `{"const":"`+act.Identifier()+`"}`)
+	}
+	for _, act := range actions.ListCalendar() {
+		expected = append(expected, `{"const":"`+act.Identifier()+`"}`)
+	}
+	for _, src := range model.SourceTypes() {
+		expected = append(expected, `{"const":"`+src.KeyIdentifier()+`"}`)
+	}
+	for key := range model.FlowTypes() {
+		expected = append(expected, `"required":["`+key+`"]`)
+	}
+	expected = append(expected,
+		`"on-error":{"type":"string"}`,
+		`"enum":["audio","display","email","procedure"]`,
+		`"before":{"$ref":"#/definitions/calendar-flows"}`,
+		`"not":{"$ref":"#/definitions/condition"}`,
+	)
+	for _, e := range expected {
+		if !strings.Contains(str, e) {
+			t.Fatalf("expected %s in schema", e)
+		}
+	}
+}
+
+// matches is a minimal validator for the keywords used by the generated schema ($ref is not followed)
+func matches(s object, v interface{}) bool {
+	if c, ok := s["const"]; ok && fmt.Sprint(c) != fmt.Sprint(v) {
+		return false
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		n := 0
+		for _, sub := range oneOf {
+			if matches(sub.(object), v) {
+				n++
+			}
+		}
+		if n != 1 {
+			return false
+		}
+	}
+	switch s["type"] {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "integer":
+		_, ok := v.(int)
+		return ok
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if items, ok := s["items"].(object); ok && !matches(items, item) {
+				return false
+			}
+		}
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		props, _ := s["properties"].(object)
+		for k, value := range m {
+			prop, ok := props[k]
+			if !ok {
+				if s["additionalProperties"] == false {
+					return false
+				}
+				if additional, ok := s["additionalProperties"].(object); ok && !matches(additional, value) {
+					return false
+				}
+				continue
+			}
+			if !matches(prop.(object), value) {
+				return false
+			}
+		}
+		required, _ := s["required"].([]string)
+		for _, k := range required {
+			if _, ok := m[k]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSourceSchema(t *testing.T) {
+	source := Generate()["properties"].(object)["source"].(object)
+	for _, tc := range []struct {
+		source string
+		valid  bool
+	}{
+		{"https://example.com/calendar.ics", true},
+		{`{type: http, url: "https://example.com/calendar.ics", headers: {Accept: text/calendar}}`, true},
+		// the options of the http source are inlined into the html source
+		{`
+type: html
+name: Events
+description: Events of the club
+url: https://example.com/events
+method: GET
+headers:
+  Accept: text/html
+timeout: 10
+selectors:
+  - parent: "#events > tr"
+    start: column-1
+    end: column-1
+    summary: column-2
+`, true},
+		{`[{type: http, url: "https://example.com/a.ics"}, {type: html, url: "https://example.com/b"}]`, true},
+		{`{type: html, options: {url: "https://example.com/events"}}`, false},
+		{`{type: http, unknown: true}`, false},
+		{`{url: "https://example.com/calendar.ics"}`, false},
+	} {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(tc.source), &v); err != nil {
+			t.Fatal(err)
+		}
+		if got := matches(source, v); got != tc.valid {
+			t.Fatalf("expected valid=%v for %s", tc.valid, tc.source)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	httpsource "github.com/darmiel/ralf/pkg/source/http"
 	"golang.org/x/net/html/charset"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -214,13 +215,14 @@ func parseEvents(doc *goquery.Document, calendar *ics.Calendar, selector Selecto
 		return fmt.Errorf("%w: %s", ErrEmptyParent, selector.Parent)
 	}
 
+	// diagnostics are written to stderr, stdout can contain the calendar (e.g. ralf run)
 	var err error
 	parents.EachWithBreak(func(_ int, selection *goquery.Selection) bool {
 		*count++
 
 		event := ics.NewEvent(strconv.Itoa(int(*count)))
 		if err = assignEventDetails(event, selection, selector); err != nil {
-			fmt.Println("error:", err)
+			fmt.Fprintln(os.Stderr, "error:", err)
 			if errors.Is(err, ErrSkip) {
 				err = nil
 				return selector.All
@@ -228,7 +230,7 @@ func parseEvents(doc *goquery.Document, calendar *ics.Calendar, selector Selecto
 			return false
 		}
 
-		fmt.Printf("Adding event: %+v\n", event)
+		fmt.Fprintf(os.Stderr, "Adding event: %+v\n", event)
 
 		calendar.AddVEvent(event)
 		return selector.All // continue with other elements if All is set
@@ -264,7 +266,7 @@ func assignEventDetails(event *ics.VEvent, root *goquery.Selection, selector Sel
 		if !selector.Soft {
 			return fmt.Errorf("%w: %s", ErrEmptySelection, selector.Start)
 		}
-		fmt.Println("start text was empty", selector.Start)
+		fmt.Fprintln(os.Stderr, "start text was empty", selector.Start)
 		return ErrSkip
 	}
 	startDate, err := time.Parse(selector.StartFormat, startText)